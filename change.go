@@ -0,0 +1,68 @@
+package sap_segmentation
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+type Change int
+
+const (
+	Unchanged Change = iota
+	Inserted
+	Updated
+)
+
+func (c Change) String() string {
+	switch c {
+	case Inserted:
+		return "inserted"
+	case Updated:
+		return "updated"
+	default:
+		return "unchanged"
+	}
+}
+
+func (c Change) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Changer tells what saving an item did to its row
+type Changer interface {
+	Changed() Change
+}
+
+type Changes struct {
+	Inserted  int64
+	Updated   int64
+	Unchanged int64
+}
+
+func (c *Changes) Count(item any) {
+	changer, ok := item.(Changer)
+	if !ok {
+		return
+	}
+	switch changer.Changed() {
+	case Inserted:
+		atomic.AddInt64(&c.Inserted, 1)
+	case Updated:
+		atomic.AddInt64(&c.Updated, 1)
+	default:
+		atomic.AddInt64(&c.Unchanged, 1)
+	}
+}
+
+func (c *Changes) Add(changes Changes) {
+	atomic.AddInt64(&c.Inserted, changes.Inserted)
+	atomic.AddInt64(&c.Updated, changes.Updated)
+	atomic.AddInt64(&c.Unchanged, changes.Unchanged)
+}
+
+func (c *Changes) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("inserted", atomic.LoadInt64(&c.Inserted)),
+		slog.Int64("updated", atomic.LoadInt64(&c.Updated)),
+		slog.Int64("unchanged", atomic.LoadInt64(&c.Unchanged)))
+}
@@ -0,0 +1,54 @@
+package sap_segmentation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Checkpointer interface {
+	Checkpoint(context.Context, int) error
+	Clear(context.Context) error
+}
+
+type Checkpoint struct {
+	*sqlx.DB
+	Source string
+}
+
+func (c Checkpoint) Checkpoint(ctx context.Context, offset int) error {
+	_, err := Ext(ctx, c.DB).ExecContext(ctx, `
+INSERT INTO checkpoint(source, run_id, "offset", updated_at)
+VALUES ($1, $2, $3, now())
+ON CONFLICT (source)
+	DO UPDATE SET run_id = excluded.run_id,
+	              "offset" = excluded."offset",
+	              updated_at = excluded.updated_at`, c.Source, RunFromContext(ctx), offset)
+	return err
+}
+
+// Clear forgets the offset of a complete run, so that a resume starts over
+func (c Checkpoint) Clear(ctx context.Context) error {
+	_, err := Ext(ctx, c.DB).ExecContext(ctx, `DELETE FROM checkpoint WHERE source = $1`, c.Source)
+	return err
+}
+
+func (c Checkpoint) Resume(ctx context.Context) (int, error) {
+	var offset int
+	err := sqlx.GetContext(ctx, Ext(ctx, c.DB), &offset, `SELECT "offset" FROM checkpoint WHERE source = $1`, c.Source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return offset, err
+}
+
+func NewCheckpoint(db *sqlx.DB, URL url.URL) Checkpoint {
+	URL.User = nil
+	return Checkpoint{
+		DB:     db,
+		Source: URL.String(),
+	}
+}
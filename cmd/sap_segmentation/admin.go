@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/pshvedko/sap_segmentation"
+	"github.com/pshvedko/sap_segmentation/internal/config"
+)
+
+var (
+	ErrRunning    = errors.New("import is running")
+	ErrNotRunning = errors.New("import is not running")
+	ErrAdminAuth  = errors.New("admin api needs a login and password")
+)
+
+type current struct {
+	Id        string
+	StartedAt time.Time
+	Progress  *sap_segmentation.Progress
+	cancel    context.CancelFunc
+}
+
+type Status struct {
+	Id        string    `json:"id"`
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"started_at"`
+	Pages     int64     `json:"pages"`
+	Offset    int64     `json:"offset"`
+	Inserted  int64     `json:"inserted"`
+	Updated   int64     `json:"updated"`
+	Unchanged int64     `json:"unchanged"`
+	Rejected  int64     `json:"rejected"`
+	Errors    int64     `json:"errors"`
+}
+
+// runner runs one import at a time for the schedule and the admin api
+type runner struct {
+	sync.Mutex
+	sync.WaitGroup
+	ctx     context.Context
+	run     func(context.Context, ...sap_segmentation.Option) error
+	current *current
+}
+
+func newRunner(ctx context.Context, cfg config.Config) *runner {
+	return &runner{
+		ctx: ctx,
+		run: func(ctx context.Context, options ...sap_segmentation.Option) error {
+			return run(ctx, cfg, false, options...)
+		},
+	}
+}
+
+func (r *runner) Start() (string, error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.current != nil {
+		return "", fmt.Errorf("%w: %s", ErrRunning, r.current.Id)
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	c := &current{
+		Id:        sap_segmentation.NewRun(),
+		StartedAt: time.Now(),
+		Progress:  &sap_segmentation.Progress{},
+		cancel:    cancel,
+	}
+	r.current = c
+	r.Add(1)
+	go func() {
+		defer r.Done()
+		defer cancel()
+		err := r.run(ctx, sap_segmentation.WithRun(c.Id), sap_segmentation.WithProgress(c.Progress))
+		if err != nil {
+			slog.Error("import", "run", c.Id, "err", err)
+		}
+		r.Lock()
+		r.current = nil
+		r.Unlock()
+	}()
+	return c.Id, nil
+}
+
+func (r *runner) Cancel(id string) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.current == nil || r.current.Id != id {
+		return fmt.Errorf("%w: %s", ErrNotRunning, id)
+	}
+	r.current.cancel()
+	return nil
+}
+
+func (r *runner) Status() (Status, bool) {
+	r.Lock()
+	c := r.current
+	r.Unlock()
+	if c == nil {
+		return Status{}, false
+	}
+	stats := c.Progress.Stats()
+	return Status{
+		Id:        c.Id,
+		Status:    "running",
+		StartedAt: c.StartedAt,
+		Pages:     stats.Pages,
+		Offset:    c.Progress.Offset(),
+		Inserted:  stats.Inserted,
+		Updated:   stats.Updated,
+		Unchanged: stats.Unchanged,
+		Rejected:  stats.Rejected,
+		Errors:    stats.Errors,
+	}, true
+}
+
+type admin struct {
+	*runner
+	sap_segmentation.Registry
+}
+
+func (a admin) Handler(basic string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /imports", a.start)
+	mux.HandleFunc("GET /imports", a.list)
+	mux.HandleFunc("GET /imports/current", a.status)
+	mux.HandleFunc("GET /imports/{id}", a.find)
+	mux.HandleFunc("DELETE /imports/{id}", a.cancel)
+	return authorization{Basic: basic, Handler: mux}
+}
+
+func (a admin) start(w http.ResponseWriter, _ *http.Request) {
+	id, err := a.Start()
+	if errors.Is(err, ErrRunning) {
+		reply(w, http.StatusConflict, err)
+		return
+	}
+	reply(w, http.StatusAccepted, map[string]string{"id": id})
+}
+
+func (a admin) cancel(w http.ResponseWriter, r *http.Request) {
+	err := a.Cancel(r.PathValue("id"))
+	if err != nil {
+		reply(w, http.StatusNotFound, err)
+		return
+	}
+	reply(w, http.StatusAccepted, map[string]string{"id": r.PathValue("id")})
+}
+
+func (a admin) status(w http.ResponseWriter, _ *http.Request) {
+	status, ok := a.Status()
+	if !ok {
+		reply(w, http.StatusNotFound, ErrNotRunning)
+		return
+	}
+	reply(w, http.StatusOK, status)
+}
+
+func (a admin) find(w http.ResponseWriter, r *http.Request) {
+	status, ok := a.Status()
+	if ok && status.Id == r.PathValue("id") {
+		reply(w, http.StatusOK, status)
+		return
+	}
+	run, err := a.Find(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		reply(w, http.StatusNotFound, err)
+	case err != nil:
+		reply(w, http.StatusInternalServerError, err)
+	default:
+		reply(w, http.StatusOK, run)
+	}
+}
+
+func (a admin) list(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	runs, err := a.List(r.Context(), limit)
+	if err != nil {
+		reply(w, http.StatusInternalServerError, err)
+		return
+	}
+	reply(w, http.StatusOK, runs)
+}
+
+func reply(w http.ResponseWriter, code int, v any) {
+	if err, ok := v.(error); ok {
+		v = map[string]string{"error": err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// newAdmin makes the admin api handler, close releases its database
+func newAdmin(cfg config.Config, r *runner) (handler http.Handler, close func(), err error) {
+	basic := cfg.AdminLoginPwd.Basic()
+	if basic == "" {
+		return nil, nil, ErrAdminAuth
+	}
+	db, err := sqlx.Open("pgx", cfg.DB.DSN("postgres"))
+	if err != nil {
+		return nil, nil, err
+	}
+	a := admin{
+		runner:   r,
+		Registry: sap_segmentation.NewRegistry(db, cfg.Conn.URL()),
+	}
+	return a.Handler(basic), func() { _ = db.Close() }, nil
+}
+
+// listen serves until the context is done, shutdown waits for the server to stop
+func listen(ctx context.Context, name, addr string, h http.Handler) (shutdown func(), err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	w := http.Server{
+		Handler:     h,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	var g sync.WaitGroup
+	g.Add(1)
+	go func() {
+		defer g.Done()
+		err := w.Serve(l)
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error(name, "err", err)
+		}
+	}()
+	slog.Info(name, "address", l.Addr().String())
+	return func() {
+		_ = w.Shutdown(context.TODO())
+		g.Wait()
+	}, nil
+}
+
+type authorization struct {
+	Basic string
+	http.Handler
+}
+
+func (h authorization) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a, ok := r.Header["Authorization"]
+	if ok && subtle.ConstantTimeCompare([]byte(a[0]), []byte(h.Basic)) == 1 {
+		h.Handler.ServeHTTP(w, r)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pshvedko/sap_segmentation"
+	"github.com/pshvedko/sap_segmentation/internal/config"
+)
+
+func TestAdmin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	release := make(chan struct{})
+	r := &runner{ctx: ctx, run: func(ctx context.Context, _ ...sap_segmentation.Option) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}}
+	defer r.Wait()
+
+	login := config.UserPassword{Userinfo: url.UserPassword("admin", "secret")}
+	s := httptest.NewServer(admin{runner: r}.Handler(login.Basic()))
+	defer s.Close()
+
+	do := func(method, path, authorization string) (*http.Response, map[string]any) {
+		req, err := http.NewRequest(method, s.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = res.Body.Close() }()
+		var body map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&body)
+		return res, body
+	}
+
+	wrong := config.UserPassword{Userinfo: url.UserPassword("admin", "wrong")}
+	for _, authorization := range []string{"", wrong.Basic()} {
+		res, _ := do(http.MethodPost, "/imports", authorization)
+		if res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("POST /imports with %q = %d, want %d", authorization, res.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	res, _ := do(http.MethodGet, "/imports/current", login.Basic())
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /imports/current = %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+
+	res, started := do(http.MethodPost, "/imports", login.Basic())
+	if res.StatusCode != http.StatusAccepted || started["id"] == "" {
+		t.Fatalf("POST /imports = %d %v, want %d", res.StatusCode, started, http.StatusAccepted)
+	}
+
+	res, _ = do(http.MethodPost, "/imports", login.Basic())
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("POST /imports while running = %d, want %d", res.StatusCode, http.StatusConflict)
+	}
+
+	res, status := do(http.MethodGet, "/imports/current", login.Basic())
+	if res.StatusCode != http.StatusOK || status["id"] != started["id"] || status["status"] != "running" {
+		t.Errorf("GET /imports/current = %d %v, want the run %v", res.StatusCode, status, started["id"])
+	}
+	if _, ok := status["errors"]; !ok {
+		t.Errorf("GET /imports/current = %v, want errors", status)
+	}
+
+	res, _ = do(http.MethodDelete, "/imports/unknown", login.Basic())
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("DELETE /imports/unknown = %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+
+	res, _ = do(http.MethodDelete, "/imports/"+started["id"].(string), login.Basic())
+	if res.StatusCode != http.StatusAccepted {
+		t.Errorf("DELETE /imports/%s = %d, want %d", started["id"], res.StatusCode, http.StatusAccepted)
+	}
+
+	close(release)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/pshvedko/sap_segmentation"
+	"github.com/pshvedko/sap_segmentation/model"
+)
+
+// dryRun prints what an import would do, the differences and rejects go as json lines when diff is on
+type dryRun struct {
+	sync.Mutex
+	out  io.Writer
+	diff bool
+}
+
+func (d *dryRun) Report(diff sap_segmentation.Difference[model.Segmentation]) {
+	if !d.diff || diff.Change == sap_segmentation.Unchanged {
+		return
+	}
+	d.print(diff)
+}
+
+func (d *dryRun) Reject(_ context.Context, item []byte, offset int, cause error) error {
+	if d.diff {
+		d.print(struct {
+			Change string          `json:"change"`
+			Offset int             `json:"offset"`
+			Item   json.RawMessage `json:"item"`
+			Error  string          `json:"error"`
+		}{Change: "rejected", Offset: offset, Item: item, Error: cause.Error()})
+	}
+	return nil
+}
+
+func (d *dryRun) Begin(context.Context) error {
+	return nil
+}
+
+func (d *dryRun) End(_ context.Context, stats sap_segmentation.Stats, _ error) error {
+	if d.diff {
+		d.print(struct {
+			Pages     int64 `json:"pages"`
+			Inserted  int64 `json:"inserted"`
+			Updated   int64 `json:"updated"`
+			Unchanged int64 `json:"unchanged"`
+			Rejected  int64 `json:"rejected"`
+		}{stats.Pages, stats.Inserted, stats.Updated, stats.Unchanged, stats.Rejected})
+		return nil
+	}
+	d.Lock()
+	defer d.Unlock()
+	w := tabwriter.NewWriter(d.out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PAGES\tINSERT\tUPDATE\tUNCHANGED\tREJECT")
+	_, _ = fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\n", stats.Pages, stats.Inserted, stats.Updated, stats.Unchanged, stats.Rejected)
+	return w.Flush()
+}
+
+func (d *dryRun) print(v any) {
+	d.Lock()
+	defer d.Unlock()
+	_ = json.NewEncoder(d.out).Encode(v)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/pshvedko/sap_segmentation"
+	"github.com/pshvedko/sap_segmentation/internal/config"
+	"github.com/pshvedko/sap_segmentation/model"
+)
+
+var (
+	ErrMigration = errors.New("migration version mismatch")
+	ErrDirty     = errors.New("migration is dirty")
+)
+
+const (
+	checkTimeout   = 5 * time.Second
+	sourceCheckTTL = time.Minute
+)
+
+type Check struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Health struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+type check struct {
+	name string
+	f    func(context.Context) error
+}
+
+// health answers the liveness probe always and the readiness probe when every check passes
+type health struct {
+	sync.Mutex
+	*sqlx.DB
+	cfg     config.Config
+	version uint
+	checks  []check
+	limiter *sap_segmentation.Limiter
+	checked time.Time
+	err     error
+}
+
+func (h *health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", h.live)
+	mux.HandleFunc("GET /readyz", h.ready)
+	return mux
+}
+
+func (h *health) live(w http.ResponseWriter, _ *http.Request) {
+	reply(w, http.StatusOK, Health{Status: "ok"})
+}
+
+func (h *health) ready(w http.ResponseWriter, r *http.Request) {
+	code := http.StatusOK
+	answer := Health{Status: "ok", Checks: map[string]Check{}}
+	for _, c := range h.checks {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		err := c.f(ctx)
+		cancel()
+		if err != nil {
+			code = http.StatusServiceUnavailable
+			answer.Status = "fail"
+			answer.Checks[c.name] = Check{Status: "fail", Error: err.Error()}
+			continue
+		}
+		answer.Checks[c.name] = Check{Status: "ok"}
+	}
+	reply(w, code, answer)
+}
+
+// migration wants the schema at the latest embedded version and not dirty
+func (h *health) migration(ctx context.Context) error {
+	var version uint
+	var dirty bool
+	err := h.QueryRowxContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: none, want %d", ErrMigration, h.version)
+	}
+	if err != nil {
+		return err
+	}
+	return h.migrated(version, dirty)
+}
+
+func (h *health) migrated(version uint, dirty bool) error {
+	if dirty {
+		return fmt.Errorf("%w: %d", ErrDirty, version)
+	}
+	if version != h.version {
+		return fmt.Errorf("%w: %d, want %d", ErrMigration, version, h.version)
+	}
+	return nil
+}
+
+// source loads a page of one item through the limiter of the probe, the result is kept for a while
+// for the probes not to load the source along with an import
+func (h *health) source(ctx context.Context) error {
+	h.Lock()
+	defer h.Unlock()
+	if !h.checked.IsZero() && time.Since(h.checked) < sourceCheckTTL {
+		return h.err
+	}
+	h.err = h.load(ctx)
+	h.checked = time.Now()
+	return h.err
+}
+
+func (h *health) load(ctx context.Context) error {
+	getter, err := newGetter(h.cfg.Conn)
+	if err != nil {
+		return err
+	}
+	pager, err := newPager(h.cfg.Conn)
+	if err != nil {
+		return err
+	}
+	loader, err := sap_segmentation.NewPagedLoader(h.limiter, pager, sap_segmentation.LogGetter(getter))
+	if err != nil {
+		return err
+	}
+	items := make(chan model.Segmentation)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range items {
+		}
+	}()
+	_, err = loader.Load(ctx, 1, items)
+	close(items)
+	<-done
+	return err
+}
+
+// latest is the last version of the embedded migrations
+func latest() (uint, error) {
+	source, err := iofs.New(migrationFS, "migration")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = source.Close() }()
+	version, err := source.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := source.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// newHealth makes the probe handler, close releases its database
+func newHealth(cfg config.Config) (handler http.Handler, close func(), err error) {
+	version, err := latest()
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := sqlx.Open("pgx", cfg.DB.DSN("postgres"))
+	if err != nil {
+		return nil, nil, err
+	}
+	h := &health{
+		DB:      db,
+		cfg:     cfg,
+		version: version,
+		limiter: sap_segmentation.NewLimiter(cfg.Conn.Interval, cfg.Conn.MaxInterval),
+	}
+	h.checks = []check{
+		{name: "db", f: db.PingContext},
+		{name: "migration", f: h.migration},
+	}
+	if cfg.HealthSource {
+		h.checks = append(h.checks, check{name: "source", f: h.source})
+	}
+	return h.Handler(), func() { _ = db.Close() }, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pshvedko/sap_segmentation"
+	"github.com/pshvedko/sap_segmentation/internal/config"
+	"github.com/pshvedko/sap_segmentation/internal/stream"
+	"github.com/pshvedko/sap_segmentation/model"
+)
+
+func TestHealth_Ready(t *testing.T) {
+	errDown := errors.New("down")
+	tests := []struct {
+		name   string
+		err    error
+		code   int
+		status string
+	}{
+		{name: "ok", code: http.StatusOK, status: "ok"},
+		{name: "fail", err: errDown, code: http.StatusServiceUnavailable, status: "fail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &health{checks: []check{
+				{name: "db", f: func(context.Context) error { return nil }},
+				{name: "migration", f: func(context.Context) error { return tt.err }},
+			}}
+			s := httptest.NewServer(h.Handler())
+			defer s.Close()
+
+			res, err := http.Get(s.URL + "/healthz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("GET /healthz = %d, want %d", res.StatusCode, http.StatusOK)
+			}
+
+			res, err = http.Get(s.URL + "/readyz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = res.Body.Close() }()
+			var answer Health
+			err = json.NewDecoder(res.Body).Decode(&answer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.code || answer.Status != tt.status {
+				t.Errorf("GET /readyz = %d %s, want %d %s", res.StatusCode, answer.Status, tt.code, tt.status)
+			}
+			if answer.Checks["db"].Status != "ok" || answer.Checks["migration"].Status != tt.status {
+				t.Errorf("GET /readyz checks = %v", answer.Checks)
+			}
+			if tt.err != nil && answer.Checks["migration"].Error != tt.err.Error() {
+				t.Errorf("GET /readyz migration error = %q, want %q", answer.Checks["migration"].Error, tt.err)
+			}
+		})
+	}
+}
+
+func TestHealth_Migrated(t *testing.T) {
+	h := &health{version: 6}
+	tests := []struct {
+		name    string
+		version uint
+		dirty   bool
+		want    error
+	}{
+		{name: "latest", version: 6},
+		{name: "dirty", version: 6, dirty: true, want: ErrDirty},
+		{name: "behind", version: 5, want: ErrMigration},
+		{name: "ahead", version: 7, want: ErrMigration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.migrated(tt.version, tt.dirty); !errors.Is(err, tt.want) {
+				t.Errorf("migrated() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatest(t *testing.T) {
+	ups, err := fs.Glob(migrationFS, "migration/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// migrations are numbered one by one from 0
+	if version != uint(len(ups)-1) {
+		t.Errorf("latest() = %d, want %d", version, len(ups)-1)
+	}
+}
+
+func TestHealth_Source(t *testing.T) {
+	var requests atomic.Int32
+	h := stream.NewHandler(10, func(offset int) model.Segmentation {
+		return model.Segmentation{AddressSapId: "A", SegmentId: int64(offset)}
+	})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Query().Get("limit") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probe := &health{
+		cfg: config.Config{Conn: config.Source{
+			URI:         *URL,
+			Timeout:     time.Second,
+			Pager:       "offset",
+			Paging:      "rows",
+			OffsetParam: "offset",
+			LimitParam:  "limit",
+			Format:      "json",
+		}},
+		limiter: sap_segmentation.NewLimiter(0, time.Second),
+	}
+
+	// the probes that follow get the result kept by the first one
+	for range 3 {
+		err = probe.source(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("source() requests = %d, want 1", n)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/pshvedko/sap_segmentation/internal/config"
+	"github.com/pshvedko/sap_segmentation/model"
+)
+
+var ErrTime = errors.New("bad time")
+
+// parseTime takes RFC 3339 or a local date, an empty string is a zero time
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %s", ErrTime, s)
+}
+
+func history(ctx context.Context, cfg config.Config, address, since, until string, asJSON bool) error {
+	from, err := parseTime(since)
+	if err != nil {
+		return err
+	}
+	to, err := parseTime(until)
+	if err != nil {
+		return err
+	}
+
+	db, err := sqlx.Open("pgx", cfg.DB.DSN("postgres"))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	histories, err := model.Histories(ctx, db, address, from, to)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(os.Stdout, histories)
+	}
+
+	return printHistory(os.Stdout, histories)
+}
+
+func printHistory(out io.Writer, histories []model.History) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CHANGED AT\tOPERATION\tADR SEGMENT\tSEGMENT ID\tRUN")
+	for _, h := range histories {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s -> %s\t%s -> %s\t%s\n",
+			h.ChangedAt.Local().Format(time.DateTime), h.Operation,
+			value(h.OldAdrSegment), value(h.NewAdrSegment),
+			value(h.OldSegmentId), value(h.NewSegmentId),
+			value(h.ImportRunId))
+	}
+	return w.Flush()
+}
+
+func value[T any](p *T) string {
+	if p == nil {
+		return "-"
+	}
+	return fmt.Sprint(*p)
+}
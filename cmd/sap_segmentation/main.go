@@ -4,6 +4,8 @@ import (
 	"context"
 	"embed"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
@@ -17,6 +19,7 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
@@ -41,6 +44,16 @@ const (
 	LogPath      = "log"
 )
 
+var metrics = sap_segmentation.NewMetrics(prometheus.DefaultRegisterer)
+
+var (
+	ErrPager  = errors.New("unknown pager")
+	ErrPaging = errors.New("unknown paging")
+	ErrDelete = errors.New("unknown delete")
+	ErrResume = errors.New("full sync can't resume")
+	ErrSeek   = errors.New("pager can't resume")
+)
+
 type Level struct {
 	p *slog.Level
 }
@@ -85,24 +98,35 @@ func main() {
 	defer stop()
 
 	var usage bool
+	var resume bool
 	var level slog.Level
+	var out io.Closer
 
 	c := &cobra.Command{
 		Use:  ModulePrefix,
 		Long: "MESH GROUP Golang test assignment",
-		PersistentPreRunE: func(*cobra.Command, []string) error {
-			return prepare(ctx, cfg, level)
+		PersistentPreRunE: func(*cobra.Command, []string) (err error) {
+			out, err = prepare(ctx, cfg, level)
+			return
 		},
 		RunE: func(*cobra.Command, []string) error {
 			if usage {
 				return envconfig.Usage(ModulePrefix, &cfg)
 			}
-			return run(ctx, cfg)
+			err := run(ctx, cfg, resume)
+			if cfg.MetricsFile != "" {
+				err = errors.Join(err, prometheus.WriteToTextfile(cfg.MetricsFile, prometheus.DefaultGatherer))
+			}
+			return err
 		},
 	}
 
 	c.PersistentFlags().VarP(NewLogLevel(&level, slog.LevelInfo), "level", "l", "level")
 	c.PersistentFlags().BoolVarP(&usage, "usage", "u", false, "usage")
+	c.Flags().BoolVar(&resume, "resume", false, "resume from the last checkpoint")
+	c.Flags().BoolVar(&cfg.ImportFullSync, "full-sync", cfg.ImportFullSync, "delete rows missing from the source")
+	c.Flags().BoolVar(&cfg.ImportDryRun, "dry-run", cfg.ImportDryRun, "compare with the table without writing")
+	c.Flags().BoolVar(&cfg.ImportDiff, "diff", cfg.ImportDiff, "print the dry run difference as json lines")
 	c.PersistentFlags().IPVar(&cfg.DB.Host, "host", cfg.DB.Host, "host")
 	c.PersistentFlags().IntVar(&cfg.DB.Port, "port", cfg.DB.Port, "port")
 	c.PersistentFlags().StringVar(&cfg.DB.User, "user", cfg.DB.User, "user")
@@ -121,6 +145,62 @@ func main() {
 	m.Flags().BoolVar(&down, "down", false, "downgrade")
 	c.AddCommand(m)
 
+	var since, until string
+	var asJSON bool
+
+	h := &cobra.Command{
+		Use:   "history address_sap_id",
+		Short: "Show segment history of an address",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return history(ctx, cfg, args[0], since, until, asJSON)
+		},
+	}
+
+	h.Flags().StringVar(&since, "since", "", "from time, RFC 3339 or date")
+	h.Flags().StringVar(&until, "until", "", "to time, RFC 3339 or date")
+	h.Flags().BoolVar(&asJSON, "json", false, "print json")
+	c.AddCommand(h)
+
+	s := &cobra.Command{
+		Use:   "serve",
+		Short: "Run imports on schedule",
+		RunE: func(*cobra.Command, []string) error {
+			return serve(ctx, cfg, func() error {
+				next, err := prepare(ctx, cfg, level)
+				if err != nil {
+					return err
+				}
+				if out != nil {
+					_ = out.Close()
+				}
+				out = next
+				return nil
+			})
+		},
+	}
+
+	s.Flags().StringVar(&cfg.Schedule, "schedule", cfg.Schedule, "cron expression or interval")
+	s.Flags().StringVar(&cfg.AdminAddr, "admin", cfg.AdminAddr, "admin api address")
+	s.Flags().StringVar(&cfg.MetricsAddr, "metrics", cfg.MetricsAddr, "metrics address")
+	s.Flags().StringVar(&cfg.HealthAddr, "health", cfg.HealthAddr, "health and readiness probe address")
+	c.AddCommand(s)
+
+	var limit int
+
+	r := &cobra.Command{
+		Use:   "runs [id]",
+		Short: "List import runs or show one",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runs(ctx, cfg, strings.Join(args, ""), limit, asJSON)
+		},
+	}
+
+	r.Flags().IntVarP(&limit, "count", "n", 20, "count")
+	r.Flags().BoolVar(&asJSON, "json", false, "print json")
+	c.AddCommand(r)
+
 	var addr string
 	var size int
 
@@ -136,7 +216,15 @@ func main() {
 	w.Flags().IntVarP(&size, "count", "n", 1000, "count")
 	c.AddCommand(w)
 
+	shutdown, err := tracing(ctx, cfg)
+	if err != nil {
+		slog.Error("tracing", "err", err)
+		os.Exit(1)
+	}
+
 	err = c.Execute()
+	// spans of an interrupted run are still flushed
+	err = errors.Join(err, shutdown(context.WithoutCancel(ctx)))
 	if err != nil {
 		os.Exit(1)
 	}
@@ -166,10 +254,11 @@ func demo(ctx context.Context, addr string, size int) error {
 	return w.ListenAndServe()
 }
 
-func prepare(_ context.Context, cfg config.Config, level slog.Level) error {
+func prepare(_ context.Context, cfg config.Config, level slog.Level) (io.Closer, error) {
 	out, err := logfile.New(LogPath, ModulePrefix, 24*time.Hour*time.Duration(cfg.LogCleanupMaxAge))
 	switch {
 	case err != nil:
+		return nil, err
 	case out != nil:
 		slog.SetDefault(
 			slog.New(
@@ -180,36 +269,183 @@ func prepare(_ context.Context, cfg config.Config, level slog.Level) error {
 			),
 		)
 	}
-	return err
+	return out, nil
 }
 
-func run(ctx context.Context, cfg config.Config) error {
-	db, err := sqlx.Open("pgx", cfg.DB.DSN("postgres"))
+func run(ctx context.Context, cfg config.Config, resume bool, extra ...sap_segmentation.Option) error {
+	dsn := cfg.DB.DSN("postgres")
+	if cfg.ImportDryRun {
+		dsn += "?default_transaction_read_only=on"
+	}
+
+	db, err := sqlx.Open("pgx", dsn)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = db.Close() }()
 
-	getter, err := sap_segmentation.NewGetter(cfg.Conn.UserAgent, cfg.Conn.Timeout, stream.Decode[model.Segmentation])
+	getter, err := newGetter(cfg.Conn)
+	if err != nil {
+		return err
+	}
+
+	limiter := sap_segmentation.NewLimiter(cfg.Conn.Interval, cfg.Conn.MaxInterval)
+	pager, err := newPager(cfg.Conn)
 	if err != nil {
 		return err
 	}
 
-	loader, err := sap_segmentation.NewLoader(cfg.Conn.Interval, cfg.Conn.URL(), "p_offset", "p_limit", getter)
+	loader, err := sap_segmentation.NewPagedLoader(limiter, pager, getter)
 	if err != nil {
 		return err
 	}
 
+	checkpoint := sap_segmentation.NewCheckpoint(db, cfg.Conn.URL())
+
+	if resume && cfg.ImportFullSync {
+		return ErrResume
+	}
+
+	// only an offset tells where to resume from
+	if resume && pager.Tell() < 0 {
+		return fmt.Errorf("%w: %s", ErrSeek, cfg.Conn.Pager)
+	}
+
+	if resume {
+		offset, err := checkpoint.Resume(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("resume", "offset", offset)
+		loader.Seek(offset)
+	}
+
 	importer, err := sap_segmentation.NewImporter(cfg.ImportBatchSize, db, loader)
 	if err != nil {
 		return err
 	}
 
+	var atomicity sap_segmentation.Atomicity
+	err = atomicity.UnmarshalText([]byte(cfg.ImportAtomicity))
+	if err != nil {
+		return err
+	}
+
+	if cfg.ImportDelete != "soft" && cfg.ImportDelete != "hard" {
+		return fmt.Errorf("%w: %s", ErrDelete, cfg.ImportDelete)
+	}
+
+	var drivers []func(sap_segmentation.Driver[model.Segmentation]) sap_segmentation.Driver[model.Segmentation]
+
+	options := []sap_segmentation.Option{
+		sap_segmentation.WithBufferSize(cfg.ImportBatchSize),
+		sap_segmentation.WithConcurrency(cfg.ImportConcurrency),
+		sap_segmentation.WithWorkers(cfg.ImportWorkers),
+		sap_segmentation.WithAtomicity(atomicity),
+	}
+
+	getters := []func(sap_segmentation.Getter[model.Segmentation]) sap_segmentation.Getter[model.Segmentation]{
+		sap_segmentation.LogGetter[model.Segmentation],
+		sap_segmentation.MetricGetter[model.Segmentation](metrics),
+	}
+
+	switch {
+	case cfg.ImportDryRun:
+		dry := &dryRun{out: os.Stdout, diff: cfg.ImportDiff}
+		drivers = append(drivers,
+			sap_segmentation.DryDriver(db, dry.Report),
+			sap_segmentation.LogDriver[model.Segmentation])
+		options = append(options,
+			sap_segmentation.WithQuarantine(dry, 0),
+			sap_segmentation.WithRecorder(dry))
+	case cfg.ImportFullSync:
+		fullSync := sap_segmentation.NewFullSync(db, cfg.ImportDelete == "hard", cfg.ImportMaxDelete)
+		drivers = append(drivers,
+			sap_segmentation.LogDriver[model.Segmentation],
+			sap_segmentation.SeenDriver[model.Segmentation](fullSync))
+		options = append(options, sap_segmentation.WithSweep(fullSync))
+	default:
+		drivers = append(drivers, sap_segmentation.LogDriver[model.Segmentation])
+	}
+
+	drivers = append(drivers, sap_segmentation.TraceDriver[model.Segmentation])
+
+	if !cfg.ImportDryRun {
+		drivers = append(drivers, sap_segmentation.MetricDriver[model.Segmentation](metrics))
+		options = append(options,
+			sap_segmentation.WithCheckpoint(checkpoint),
+			sap_segmentation.WithQuarantine(sap_segmentation.NewQuarantine(db), cfg.ImportMaxRejects),
+			sap_segmentation.WithObserver(metrics),
+			sap_segmentation.WithRecorder(sap_segmentation.Recorders(
+				sap_segmentation.NewRegistry(db, cfg.Conn.URL()),
+				metrics)))
+	}
+
+	retry := sap_segmentation.Retry{
+		Attempts:  cfg.Conn.Retry.Attempts,
+		Base:      cfg.Conn.Retry.Base,
+		Max:       cfg.Conn.Retry.Max,
+		Jitter:    cfg.Conn.Retry.Jitter,
+		Retryable: sap_segmentation.Temporary(cfg.Conn.Retry.Codes...),
+	}
+
 	return importer.
-		WithGetter(sap_segmentation.LogGetter[model.Segmentation]).
-		WithDriver(sap_segmentation.LogDriver[model.Segmentation]).
-		Import(ctx,
-			sap_segmentation.WithBufferSize(cfg.ImportBatchSize))
+		WithGetter(append(getters, sap_segmentation.RetryGetter[model.Segmentation](retry))...).
+		WithDriver(drivers...).
+		Import(ctx, append(options, extra...)...)
+}
+
+func newGetter(cfg config.Source) (sap_segmentation.Getter[model.Segmentation], error) {
+	format := stream.Format[model.Segmentation]{
+		Items:   cfg.Items,
+		Comma:   stream.Comma(cfg.CsvComma),
+		Charset: cfg.Charset,
+		Element: cfg.XmlElement,
+	}
+
+	if cfg.Lenient {
+		format.Lenient = func(ctx context.Context, e *stream.ItemError) error {
+			return sap_segmentation.Reject(ctx, e.Raw, e.Index, e)
+		}
+	}
+
+	decoder, err := format.Decoder(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sap_segmentation.Get[model.Segmentation]{
+		Client:      http.Client{Timeout: cfg.Timeout},
+		Decoder:     decoder,
+		UserAgent:   cfg.UserAgent,
+		Accept:      format.Accept(cfg.Format),
+		Compression: cfg.Compression,
+	}, nil
+}
+
+func newPager(cfg config.Source) (sap_segmentation.Pager, error) {
+	switch cfg.Pager {
+	case "offset":
+		if cfg.Paging != "rows" && cfg.Paging != "pages" {
+			return nil, fmt.Errorf("%w: %s", ErrPaging, cfg.Paging)
+		}
+		return &sap_segmentation.Page{
+			URL:     cfg.URL(),
+			Offset:  cfg.OffsetParam,
+			Limit:   cfg.LimitParam,
+			Base:    cfg.Start,
+			Pages:   cfg.Paging == "pages",
+			Overlap: cfg.OverlapCheck,
+		}, nil
+	case "keyset":
+		return sap_segmentation.NewKeysetPager(cfg.URL(), cfg.Cursor, cfg.LimitParam), nil
+	case "cursor":
+		return sap_segmentation.NewCursorPager(cfg.URL(), cfg.Cursor, cfg.LimitParam, cfg.CursorHeader), nil
+	case "link":
+		return sap_segmentation.NewLinkPager(cfg.URL(), cfg.LimitParam), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrPager, cfg.Pager)
+	}
 }
 
 //go:embed migration
@@ -0,0 +1,7 @@
+create table if not exists checkpoint
+(
+    source     varchar(2048) primary key,
+    run_id     varchar(32) not null,
+    "offset"   bigint      not null,
+    updated_at timestamptz not null default now()
+);
@@ -0,0 +1,11 @@
+create table if not exists segment_rejected
+(
+    id            bigserial primary key,
+    run_id        varchar(32) not null,
+    source_offset bigint,
+    raw           text        not null,
+    error         text        not null,
+    created_at    timestamptz not null default now()
+);
+
+create index if not exists segment_rejected_run_id on segment_rejected (run_id);
@@ -0,0 +1,4 @@
+drop table if exists segment_seen;
+
+alter table segment
+    drop column if exists deleted_at;
@@ -0,0 +1,9 @@
+alter table segment
+    add column if not exists deleted_at timestamptz;
+
+create unlogged table if not exists segment_seen
+(
+    run_id         varchar(32)  not null,
+    address_sap_id varchar(255) not null,
+    primary key (run_id, address_sap_id)
+);
@@ -0,0 +1,4 @@
+alter table segment
+    drop column if exists import_run_id,
+    drop column if exists updated_at,
+    drop column if exists created_at;
@@ -0,0 +1,4 @@
+alter table segment
+    add column if not exists created_at    timestamptz not null default now(),
+    add column if not exists updated_at    timestamptz not null default now(),
+    add column if not exists import_run_id varchar(32);
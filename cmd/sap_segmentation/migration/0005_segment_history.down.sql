@@ -0,0 +1,5 @@
+drop trigger if exists segment_history on segment;
+
+drop function if exists segment_history();
+
+drop table if exists segment_history;
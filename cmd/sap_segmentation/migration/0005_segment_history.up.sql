@@ -0,0 +1,44 @@
+create table if not exists segment_history
+(
+    id              bigserial primary key,
+    address_sap_id  varchar(255) not null,
+    operation       varchar(8)   not null,
+    old_adr_segment varchar(16),
+    new_adr_segment varchar(16),
+    old_segment_id  bigint,
+    new_segment_id  bigint,
+    import_run_id   varchar(32),
+    changed_at      timestamptz  not null default now()
+);
+
+create index if not exists segment_history_address_sap_id on segment_history (address_sap_id, changed_at);
+
+create or replace function segment_history() returns trigger as
+$$
+begin
+    if tg_op = 'INSERT' then
+        insert into segment_history(address_sap_id, operation, new_adr_segment, new_segment_id, import_run_id)
+        values (new.address_sap_id, 'insert', new.adr_segment, new.segment_id, new.import_run_id);
+    elsif tg_op = 'DELETE' then
+        insert into segment_history(address_sap_id, operation, old_adr_segment, old_segment_id, import_run_id)
+        values (old.address_sap_id, 'delete', old.adr_segment, old.segment_id, old.import_run_id);
+    elsif new.deleted_at is not null and old.deleted_at is null then
+        insert into segment_history(address_sap_id, operation, old_adr_segment, old_segment_id, import_run_id)
+        values (old.address_sap_id, 'delete', old.adr_segment, old.segment_id, new.import_run_id);
+    else
+        insert into segment_history(address_sap_id, operation, old_adr_segment, new_adr_segment,
+                                    old_segment_id, new_segment_id, import_run_id)
+        values (new.address_sap_id, case when old.deleted_at is null then 'update' else 'restore' end,
+                old.adr_segment, new.adr_segment, old.segment_id, new.segment_id, new.import_run_id);
+    end if;
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists segment_history on segment;
+
+create trigger segment_history
+    after insert or update or delete
+    on segment
+    for each row
+execute function segment_history();
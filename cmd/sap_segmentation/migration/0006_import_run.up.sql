@@ -0,0 +1,16 @@
+create table if not exists import_run
+(
+    id          varchar(32) primary key,
+    source      varchar(2048) not null,
+    status      varchar(16)   not null,
+    started_at  timestamptz   not null default now(),
+    finished_at timestamptz,
+    pages       bigint        not null default 0,
+    inserted    bigint        not null default 0,
+    updated     bigint        not null default 0,
+    unchanged   bigint        not null default 0,
+    rejected    bigint        not null default 0,
+    error       text
+);
+
+create index if not exists import_run_started_at on import_run (started_at);
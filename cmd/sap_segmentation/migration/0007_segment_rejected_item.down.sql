@@ -0,0 +1,2 @@
+alter table segment_rejected
+    rename column item to raw;
@@ -0,0 +1,2 @@
+alter table segment_rejected
+    rename column raw to item;
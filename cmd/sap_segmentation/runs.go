@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/pshvedko/sap_segmentation"
+	"github.com/pshvedko/sap_segmentation/internal/config"
+)
+
+func runs(ctx context.Context, cfg config.Config, id string, limit int, asJSON bool) error {
+	db, err := sqlx.Open("pgx", cfg.DB.DSN("postgres"))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	registry := sap_segmentation.NewRegistry(db, cfg.Conn.URL())
+
+	var list []sap_segmentation.ImportRun
+	if id == "" {
+		list, err = registry.List(ctx, limit)
+	} else {
+		var run sap_segmentation.ImportRun
+		run, err = registry.Find(ctx, id)
+		list = append(list, run)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case asJSON && id != "":
+		return printJSON(os.Stdout, list[0])
+	case asJSON:
+		return printJSON(os.Stdout, list)
+	case id != "":
+		return printRun(os.Stdout, list[0])
+	default:
+		return printRuns(os.Stdout, list)
+	}
+}
+
+func printJSON(out io.Writer, v any) error {
+	e := json.NewEncoder(out)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+func printRuns(out io.Writer, list []sap_segmentation.ImportRun) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tSTARTED AT\tDURATION\tSTATUS\tPAGES\tINSERTED\tUPDATED\tUNCHANGED\tREJECTED")
+	for _, r := range list {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+			r.Id, r.StartedAt.Local().Format(time.DateTime), r.Duration().Round(time.Millisecond), r.Status,
+			r.Pages, r.Inserted, r.Updated, r.Unchanged, r.Rejected)
+	}
+	return w.Flush()
+}
+
+func printRun(out io.Writer, r sap_segmentation.ImportRun) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "ID\t%s\n", r.Id)
+	_, _ = fmt.Fprintf(w, "SOURCE\t%s\n", r.Source)
+	_, _ = fmt.Fprintf(w, "STATUS\t%s\n", r.Status)
+	_, _ = fmt.Fprintf(w, "STARTED AT\t%s\n", r.StartedAt.Local().Format(time.DateTime))
+	_, _ = fmt.Fprintf(w, "FINISHED AT\t%s\n", value(r.FinishedAt))
+	_, _ = fmt.Fprintf(w, "DURATION\t%s\n", r.Duration().Round(time.Millisecond))
+	_, _ = fmt.Fprintf(w, "PAGES\t%d\n", r.Pages)
+	_, _ = fmt.Fprintf(w, "INSERTED\t%d\n", r.Inserted)
+	_, _ = fmt.Fprintf(w, "UPDATED\t%d\n", r.Updated)
+	_, _ = fmt.Fprintf(w, "UNCHANGED\t%d\n", r.Unchanged)
+	_, _ = fmt.Fprintf(w, "REJECTED\t%d\n", r.Rejected)
+	_, _ = fmt.Fprintf(w, "ERROR\t%s\n", value(r.Error))
+	return w.Flush()
+}
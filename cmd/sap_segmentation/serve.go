@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robfig/cron/v3"
+
+	"github.com/pshvedko/sap_segmentation/internal/config"
+)
+
+var ErrSchedule = errors.New("bad schedule")
+
+// newSchedule takes an interval like 15m or a standard cron expression like "0 3 * * *"
+func newSchedule(spec string) (cron.Schedule, error) {
+	every, err := time.ParseDuration(spec)
+	if err == nil {
+		if every <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrSchedule, spec)
+		}
+		return cron.Every(every), nil
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrSchedule, spec, err)
+	}
+	return schedule, nil
+}
+
+// serve runs imports on schedule until the context is done, a run still going skips its next turn
+func serve(ctx context.Context, cfg config.Config, reopen func() error) error {
+	schedule, err := newSchedule(cfg.Schedule)
+	if err != nil {
+		return err
+	}
+
+	r := newRunner(ctx, cfg)
+	defer r.Wait()
+
+	if cfg.AdminAddr != "" {
+		h, close, err := newAdmin(cfg, r)
+		if err != nil {
+			return err
+		}
+		defer close()
+		shutdown, err := listen(ctx, "admin", cfg.AdminAddr, h)
+		if err != nil {
+			return err
+		}
+		defer shutdown()
+	}
+
+	if cfg.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", promhttp.Handler())
+		shutdown, err := listen(ctx, "metrics", cfg.MetricsAddr, mux)
+		if err != nil {
+			return err
+		}
+		defer shutdown()
+	}
+
+	if cfg.HealthAddr != "" {
+		h, close, err := newHealth(cfg)
+		if err != nil {
+			return err
+		}
+		defer close()
+		shutdown, err := listen(ctx, "health", cfg.HealthAddr, h)
+		if err != nil {
+			return err
+		}
+		defer shutdown()
+	}
+
+	return loop(ctx, schedule, r, reopen)
+}
+
+// loop starts an import on every turn of the schedule and reopens the log every day until the context is done
+func loop(ctx context.Context, schedule cron.Schedule, r *runner, reopen func() error) error {
+	day := time.NewTicker(24 * time.Hour)
+	defer day.Stop()
+
+	next := schedule.Next(time.Now())
+	slog.Info("schedule", "next", next)
+
+	for {
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-day.C:
+			t.Stop()
+			err := reopen()
+			if err != nil {
+				slog.Error("log", "err", err)
+			}
+		case now := <-t.C:
+			next = schedule.Next(now)
+			_, err := r.Start()
+			if err != nil {
+				slog.Warn("import skipped", "next", next, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pshvedko/sap_segmentation"
+)
+
+func TestNewSchedule(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec    string
+		next    time.Time
+		wantErr error
+	}{
+		{spec: "15m", next: now.Add(15 * time.Minute)},
+		{spec: "0 3 * * *", next: time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC)},
+		{spec: "0s", wantErr: ErrSchedule},
+		{spec: "-1h", wantErr: ErrSchedule},
+		{spec: "every day", wantErr: ErrSchedule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := newSchedule(tt.spec)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("newSchedule() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := schedule.Next(now); !got.Equal(tt.next) {
+				t.Errorf("Next() = %v, want %v", got, tt.next)
+			}
+		})
+	}
+}
+
+// every is a schedule shorter than the second of cron.Every
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func TestLoop_Skip(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var runs atomic.Int32
+	release := make(chan struct{})
+	r := &runner{ctx: ctx, run: func(ctx context.Context, _ ...sap_segmentation.Option) error {
+		runs.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}}
+	defer r.Wait()
+
+	done := make(chan error)
+	go func() { done <- loop(ctx, every(10*time.Millisecond), r, nil) }()
+
+	// the turns of a run still going are skipped
+	time.Sleep(100 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("loop() runs = %d, want 1", n)
+	}
+
+	close(release)
+	time.Sleep(100 * time.Millisecond)
+	if n := runs.Load(); n < 2 {
+		t.Errorf("loop() runs = %d, want a run after the first one", n)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("loop() error = %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package sap_segmentation
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const Encodings = "gzip, deflate, zstd"
+
+var ErrEncoding = errors.New("unsupported content encoding")
+
+type counter struct {
+	io.Reader
+	n int64
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func Decompress(encoding string, r io.Reader) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	var err error
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case "gzip", "x-gzip":
+		rc, err = gzip.NewReader(r)
+	case "deflate":
+		// zlib wrapped as RFC 9110 says, though some servers send raw deflate
+		b := bufio.NewReader(r)
+		h, _ := b.Peek(2)
+		if len(h) == 2 && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+			rc, err = zlib.NewReader(b)
+		} else {
+			rc = flate.NewReader(b)
+		}
+	case "zstd":
+		var d *zstd.Decoder
+		d, err = zstd.NewReader(r)
+		if err == nil {
+			rc = d.IOReadCloser()
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrEncoding, encoding)
+	}
+	if errors.Is(err, io.EOF) {
+		// an empty body has no header to read
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	return rc, err
+}
@@ -0,0 +1,85 @@
+package sap_segmentation
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
+)
+
+func TestGet_Compression(t *testing.T) {
+	body := `[` + strings.Repeat(`{"id":1},`, 99) + `{"id":1}]`
+	tests := []struct {
+		name     string
+		encoding string
+		writer   func(io.Writer) io.WriteCloser
+	}{
+		{name: "identity", encoding: "", writer: func(w io.Writer) io.WriteCloser { return nopCloser{w} }},
+		{name: "gzip", encoding: "gzip", writer: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{name: "zlib", encoding: "deflate", writer: func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+		{name: "flate", encoding: "deflate", writer: func(w io.Writer) io.WriteCloser {
+			f, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return f
+		}},
+		{name: "zstd", encoding: "zstd", writer: func(w io.Writer) io.WriteCloser {
+			z, _ := zstd.NewWriter(w)
+			return z
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			w := tt.writer(&b)
+			_, _ = io.WriteString(w, body)
+			_ = w.Close()
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept-Encoding") != Encodings {
+					w.WriteHeader(http.StatusNotAcceptable)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				_, _ = w.Write(b.Bytes())
+			}))
+			defer s.Close()
+			URL, err := url.Parse(s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			getter, err := NewGetter("test", 0, stream.Decode[Object])
+			if err != nil {
+				t.Fatal(err)
+			}
+			var reply Reply
+			c := make(chan Object, 100)
+			n, err := getter.Get(stream.ContextWithReply(context.TODO(), &reply), *URL, c)
+			if err != nil || n != 100 {
+				t.Fatalf("Get() = %d, %v", n, err)
+			}
+			if reply.Compressed != int64(b.Len()) || reply.Decompressed != int64(len(body)) {
+				t.Errorf("Get() bytes = %d/%d, want %d/%d", reply.Compressed, reply.Decompressed, b.Len(), len(body))
+			}
+		})
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
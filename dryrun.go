@@ -0,0 +1,66 @@
+package sap_segmentation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrDiff = errors.New("can't diff")
+
+type Difference[T any] struct {
+	Change Change `json:"change"`
+	Old    *T     `json:"old,omitempty"`
+	New    T      `json:"new"`
+}
+
+// Differ tells what saving would do to the stored row without writing it, New carries the change
+type Differ[T any] interface {
+	Diff(context.Context, sqlx.QueryerContext) (Difference[T], error)
+}
+
+type Dry[T Putter[T]] struct {
+	Driver[T]
+	*sqlx.DB
+	Report func(Difference[T])
+}
+
+func (d Dry[T]) Save(ctx context.Context, item T) (T, error) {
+	differ, ok := any(item).(Differ[T])
+	if !ok {
+		return item, fmt.Errorf("%w: %T", ErrDiff, item)
+	}
+	diff, err := differ.Diff(ctx, d.DB)
+	if err != nil {
+		return item, err
+	}
+	if d.Report != nil {
+		d.Report(diff)
+	}
+	return diff.New, nil
+}
+
+func (d Dry[T]) SaveBatch(ctx context.Context, items []T) ([]T, error) {
+	saved := make([]T, 0, len(items))
+	for _, item := range items {
+		item, err := d.Save(ctx, item)
+		if err != nil {
+			return saved, err
+		}
+		saved = append(saved, item)
+	}
+	return saved, nil
+}
+
+func (d Dry[T]) Transaction(ctx context.Context, f func(context.Context) error) error {
+	return f(ctx)
+}
+
+// DryDriver compares items with the table instead of saving them, it has to be the first wrapper
+func DryDriver[T Putter[T]](db *sqlx.DB, report func(Difference[T])) func(Driver[T]) Driver[T] {
+	return func(driver Driver[T]) Driver[T] {
+		return Dry[T]{Driver: driver, DB: db, Report: report}
+	}
+}
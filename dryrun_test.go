@@ -0,0 +1,52 @@
+package sap_segmentation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Diffed struct {
+	ID     int `json:"id"`
+	change Change
+}
+
+func (d Diffed) Put(context.Context, sqlx.ExtContext) (Diffed, error) {
+	return d, errors.New("written")
+}
+
+func (d Diffed) Changed() Change {
+	return d.change
+}
+
+func (d Diffed) Diff(context.Context, sqlx.QueryerContext) (Difference[Diffed], error) {
+	d.change = Inserted
+	if d.ID%2 == 1 {
+		d.change = Unchanged
+	}
+	return Difference[Diffed]{Change: d.change, New: d}, nil
+}
+
+func TestImport_DryRun(t *testing.T) {
+	importer, err := NewImporter(8, &sqlx.DB{}, newTestLoader(t, 30, func(offset int) Diffed {
+		return Diffed{ID: offset}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var diffs []Difference[Diffed]
+	var record Record
+	err = importer.
+		WithDriver(DryDriver(nil, func(diff Difference[Diffed]) { diffs = append(diffs, diff) })).
+		Import(context.TODO(), WithRecorder(&record), WithAtomicity(AtomicPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diffs) != 30 || record.stats.Inserted != 15 || record.stats.Unchanged != 15 {
+		t.Errorf("Import() diffs = %d, stats = %+v, want 30 diffs, 15 inserted and 15 unchanged", len(diffs), record.stats)
+	}
+}
@@ -0,0 +1,64 @@
+package sap_segmentation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const SnippetSize = 512
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrThrottled    = errors.New("throttled")
+	ErrServer       = errors.New("server error")
+)
+
+type HTTPStatusError struct {
+	StatusCode int
+	URL        string
+	Header     http.Header
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s: %d %s: %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+func (e *HTTPStatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrThrottled:
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	default:
+		return false
+	}
+}
+
+type ContentTypeError struct {
+	ContentType string
+	URL         string
+	Body        string
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("%s: unexpected content type %q: %s", e.URL, e.ContentType, e.Body)
+}
+
+// Snippet reads the beginning of a body for error messages
+func Snippet(r io.Reader) string {
+	b, _ := io.ReadAll(io.LimitReader(r, SnippetSize+1))
+	s := strings.ToValidUTF8(strings.TrimSpace(string(b)), "")
+	if len(b) > SnippetSize {
+		s = s[:min(len(s), SnippetSize)] + "..."
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+package sap_segmentation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrSweep = errors.New("too many rows to delete")
+
+type Marker interface {
+	Mark(context.Context, []string) error
+}
+
+type Sweeper interface {
+	Sweep(context.Context) error
+	// Forget drops the keys of the run whether it swept or not
+	Forget(context.Context) error
+}
+
+// FullSync remembers the keys seen by a run and deletes the segments missing from it
+type FullSync struct {
+	*sqlx.DB
+	Hard       bool
+	MaxPercent float64
+}
+
+func (f FullSync) Mark(ctx context.Context, keys []string) error {
+	_, err := Ext(ctx, f.DB).ExecContext(ctx, `
+INSERT INTO segment_seen(run_id, address_sap_id)
+SELECT $1, unnest($2::text[])
+ON CONFLICT DO NOTHING`, RunFromContext(ctx), keys)
+	return err
+}
+
+func (f FullSync) Sweep(ctx context.Context) error {
+	return Transaction(ctx, f.DB, func(ctx context.Context) error {
+		db := Ext(ctx, f.DB)
+		run := RunFromContext(ctx)
+		live := `deleted_at IS NULL`
+		if f.Hard {
+			live = `TRUE`
+		}
+		var count struct {
+			Total   int64 `db:"total"`
+			Missing int64 `db:"missing"`
+		}
+		err := sqlx.GetContext(ctx, db, &count, `
+SELECT count(*) AS total,
+       count(*) FILTER (WHERE NOT EXISTS(SELECT FROM segment_seen WHERE run_id = $1 AND address_sap_id = s.address_sap_id)) AS missing
+FROM segment s
+WHERE `+live, run)
+		if err != nil {
+			return err
+		}
+		if count.Missing > 0 && float64(count.Missing)*100 > f.MaxPercent*float64(count.Total) {
+			return fmt.Errorf("%w: %d of %d", ErrSweep, count.Missing, count.Total)
+		}
+		query := `UPDATE segment s SET deleted_at = now(), import_run_id = $1`
+		if f.Hard {
+			query = `DELETE FROM segment s`
+		}
+		_, err = db.ExecContext(ctx, query+`
+WHERE `+live+` AND NOT EXISTS(SELECT FROM segment_seen WHERE run_id = $1 AND address_sap_id = s.address_sap_id)`, run)
+		if err != nil {
+			return err
+		}
+		slog.Info("sweep", "deleted", count.Missing, "total", count.Total, "hard", f.Hard)
+		return nil
+	})
+}
+
+func (f FullSync) Forget(ctx context.Context) error {
+	_, err := f.ExecContext(ctx, `DELETE FROM segment_seen WHERE run_id = $1`, RunFromContext(ctx))
+	return err
+}
+
+func NewFullSync(db *sqlx.DB, hard bool, maxPercent float64) FullSync {
+	return FullSync{
+		DB:         db,
+		Hard:       hard,
+		MaxPercent: maxPercent,
+	}
+}
+
+type S[T Putter[T]] struct {
+	Driver[T]
+	Marker
+}
+
+func (s S[T]) Save(ctx context.Context, item T) (T, error) {
+	saved, err := s.Driver.Save(ctx, item)
+	if err != nil {
+		return saved, err
+	}
+	return saved, s.Mark(ctx, []string{any(item).(Keyer).Key()})
+}
+
+func (s S[T]) SaveBatch(ctx context.Context, items []T) ([]T, error) {
+	saved, err := s.Driver.SaveBatch(ctx, items)
+	if err != nil {
+		return saved, err
+	}
+	keys := make([]string, len(items))
+	for n, item := range items {
+		keys[n] = any(item).(Keyer).Key()
+	}
+	return saved, s.Mark(ctx, keys)
+}
+
+// SeenDriver marks the keys of saved items, T must be a Keyer
+func SeenDriver[T Putter[T]](marker Marker) func(Driver[T]) Driver[T] {
+	return func(driver Driver[T]) Driver[T] {
+		return S[T]{Driver: driver, Marker: marker}
+	}
+}
@@ -0,0 +1,118 @@
+package sap_segmentation
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
+)
+
+type Seen struct {
+	ID int `json:"id"`
+}
+
+func (s Seen) Key() string {
+	return strconv.Itoa(s.ID)
+}
+
+func (s Seen) Put(context.Context, sqlx.ExtContext) (Seen, error) {
+	return s, nil
+}
+
+type Sync struct {
+	keys    map[string]bool
+	sweeps  int
+	forgets int
+}
+
+func (s *Sync) Mark(_ context.Context, keys []string) error {
+	for _, key := range keys {
+		s.keys[key] = true
+	}
+	return nil
+}
+
+func (s *Sync) Sweep(context.Context) error {
+	s.sweeps++
+	return nil
+}
+
+func (s *Sync) Forget(context.Context) error {
+	s.forgets++
+	return nil
+}
+
+func newTestLoader[T Putter[T]](t *testing.T, count int, f func(int) T) Loader[T] {
+	s := httptest.NewServer(stream.NewHandler(count, f))
+	t.Cleanup(s.Close)
+
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter, err := NewGetter("test", 0, stream.Decode[T])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader, err := NewLoader(0, *URL, "offset", "limit", getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loader
+}
+
+func TestImport_Sweep(t *testing.T) {
+	sync := Sync{keys: map[string]bool{}}
+
+	importer, err := NewImporter(4, &sqlx.DB{}, newTestLoader(t, 30, func(offset int) Seen {
+		return Seen{ID: offset}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = importer.WithDriver(SeenDriver[Seen](&sync)).Import(context.TODO(), WithSweep(&sync))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sync.keys) != 30 || sync.sweeps != 1 {
+		t.Errorf("Import() keys = %d, sweeps = %d, want 30 and 1", len(sync.keys), sync.sweeps)
+	}
+
+	checked, err := NewImporter(4, &sqlx.DB{}, newTestLoader(t, 30, func(offset int) Checked {
+		return Checked{ID: offset + 1}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rejects Rejects
+	err = checked.Import(context.TODO(), WithQuarantine(&rejects, 0), WithSweep(&sync))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rejects) == 0 || sync.sweeps != 1 {
+		t.Errorf("Import() rejects = %v, sweeps = %d, want a sweep skipped", rejects, sync.sweeps)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = importer.WithDriver(SeenDriver[Seen](&sync)).Import(ctx, WithSweep(&sync))
+	if err == nil {
+		t.Fatal("Import() error = nil, want cancelled")
+	}
+
+	if sync.sweeps != 1 || sync.forgets != 3 {
+		t.Errorf("Import() sweeps = %d, forgets = %d, want 1 and 3", sync.sweeps, sync.forgets)
+	}
+}
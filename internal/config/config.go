@@ -2,6 +2,7 @@ package config
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net"
@@ -34,6 +35,15 @@ func (u *UserPassword) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// Basic is the value of a basic Authorization header, empty without user info
+func (u UserPassword) Basic() string {
+	if u.Userinfo == nil {
+		return ""
+	}
+	password, _ := u.Password()
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password))
+}
+
 type DataBase struct {
 	Host     net.IP `default:"127.0.0.1" desc:"host"`
 	Port     int    `default:"5432" desc:"port"`
@@ -51,12 +61,37 @@ func (db DataBase) DSN(scheme string) string {
 	})
 }
 
+type Retry struct {
+	Attempts int           `default:"3" desc:"retry attempts"`
+	Base     time.Duration `default:"500ms" desc:"retry base delay"`
+	Max      time.Duration `default:"30s" desc:"retry max delay"`
+	Jitter   float64       `default:"0.2" desc:"retry jitter"`
+	Codes    []int         `default:"408,429,500,502,503,504" desc:"retry status codes"`
+}
+
 type Source struct {
 	URI          url.URL       `default:"http://bsm.api.iql.ru/ords/bsm/segmentation/get_segmentation" desc:"uri"`
 	AuthLoginPwd UserPassword  `default:"4Dfddf5:jKlljHGH" split_words:"true" desc:"auth login password"`
 	UserAgent    string        `default:"spacecount-test" split_words:"true" desc:"user agent"`
 	Timeout      time.Duration `default:"5s" desc:"timeout"`
 	Interval     time.Duration `default:"1500ms" desc:"interval"`
+	MaxInterval  time.Duration `default:"1m" split_words:"true" desc:"max interval when throttled"`
+	Pager        string        `default:"offset" desc:"pager: offset, keyset, cursor or link"`
+	Cursor       string        `default:"p_cursor" desc:"cursor or last key parameter"`
+	CursorHeader string        `split_words:"true" desc:"cursor response header"`
+	OffsetParam  string        `default:"p_offset" split_words:"true" desc:"offset parameter"`
+	LimitParam   string        `default:"p_limit" split_words:"true" desc:"limit parameter"`
+	Start        int           `default:"0" desc:"first offset"`
+	Paging       string        `default:"rows" desc:"offset counts rows or pages"`
+	OverlapCheck bool          `default:"true" split_words:"true" desc:"warn when pages overlap"`
+	Items        string        `default:"items" desc:"path of the items array"`
+	Format       string        `default:"auto" desc:"format: auto, json, ndjson, csv or xml"`
+	CsvComma     string        `default:";" split_words:"true" desc:"csv delimiter"`
+	Charset      string        `desc:"csv or xml charset"`
+	XmlElement   string        `default:"item" split_words:"true" desc:"xml item element"`
+	Lenient      bool          `default:"false" desc:"quarantine items that fail to decode"`
+	Compression  bool          `default:"true" desc:"accept compressed responses"`
+	Retry        Retry
 }
 
 func (s Source) URL() url.URL {
@@ -66,10 +101,29 @@ func (s Source) URL() url.URL {
 }
 
 type Config struct {
-	DB               DataBase
-	Conn             Source
-	ImportBatchSize  int `default:"50" split_words:"true" desc:"import batch size"`
-	LogCleanupMaxAge int `default:"7" split_words:"true" desc:"log cleanup max age"`
+	DB                DataBase
+	Conn              Source
+	ImportBatchSize   int          `default:"50" split_words:"true" desc:"import batch size"`
+	ImportAtomicity   string       `default:"row" split_words:"true" desc:"import atomicity: row, page or run"`
+	ImportConcurrency int          `default:"1" split_words:"true" desc:"import page fetch concurrency"`
+	ImportWorkers     int          `default:"1" split_words:"true" desc:"import save workers"`
+	ImportMaxRejects  int          `default:"1000" split_words:"true" desc:"rejected rows to abort the import, 0 is unlimited"`
+	ImportFullSync    bool         `default:"false" split_words:"true" desc:"delete rows missing from the source"`
+	ImportDelete      string       `default:"soft" split_words:"true" desc:"full sync delete: soft or hard"`
+	ImportMaxDelete   float64      `default:"10" split_words:"true" desc:"max percent of rows a full sync deletes"`
+	ImportDryRun      bool         `default:"false" split_words:"true" desc:"compare with the table without writing"`
+	ImportDiff        bool         `default:"false" split_words:"true" desc:"print the dry run difference as json lines"`
+	Schedule          string       `default:"1h" desc:"import schedule: cron expression or interval"`
+	AdminAddr         string       `split_words:"true" desc:"admin api address, off when empty"`
+	AdminLoginPwd     UserPassword `split_words:"true" desc:"admin api login password"`
+	MetricsAddr       string       `split_words:"true" desc:"metrics address, off when empty"`
+	MetricsFile       string       `split_words:"true" desc:"textfile collector file written after a run"`
+	HealthAddr        string       `split_words:"true" desc:"health and readiness probe address, off when empty"`
+	HealthSource      bool         `default:"false" split_words:"true" desc:"readiness fetches one item from the source"`
+	TraceExporter     string       `default:"none" split_words:"true" desc:"trace exporter: none, stdout, file or otlp"`
+	TraceFile         string       `default:"trace.json" split_words:"true" desc:"trace file of the file exporter"`
+	TraceEndpoint     string       `split_words:"true" desc:"otlp http endpoint url, OTEL_EXPORTER_OTLP_ENDPOINT when empty"`
+	LogCleanupMaxAge  int          `default:"7" split_words:"true" desc:"log cleanup max age"`
 }
 
 type Hidden struct {
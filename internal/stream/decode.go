@@ -3,33 +3,237 @@ package stream
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
 )
 
-func Decode[T any](ctx context.Context, r io.Reader, c chan<- T) (n int, err error) {
+var ErrNoItems = errors.New("no items in the object")
+
+// ItemError is an array value that doesn't decode into an item, Offset is the byte offset of the value
+type ItemError struct {
+	Index  int
+	Offset int64
+	Raw    json.RawMessage
+	Err    error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("item %d at %d: %v", e.Index, e.Offset, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// Report takes a value that doesn't decode, decoding goes on unless it returns an error
+type Report func(context.Context, *ItemError) error
+
+func Decode[T any](ctx context.Context, r io.Reader, c chan<- T) (int, error) {
+	return decode(ctx, r, c, nil)
+}
+
+// DecodeLenient decodes every array value on its own and reports the ones that fail
+func DecodeLenient[T any](report Report) func(context.Context, io.Reader, chan<- T) (int, error) {
+	return func(ctx context.Context, r io.Reader, c chan<- T) (int, error) {
+		return decode(ctx, r, c, report)
+	}
+}
+
+func decode[T any](ctx context.Context, r io.Reader, c chan<- T, report Report) (n int, err error) {
+	reply, _ := ReplyFromContext(ctx)
 	j := json.NewDecoder(r)
 	// read open bracket
 	_, err = j.Token()
 	if err != nil {
 		return
 	}
+	n, err = decodeArray(ctx, j, c, reply, report)
+	if err != nil {
+		return
+	}
+	// read closing bracket
+	_, err = j.Token()
+	return
+}
+
+func decodeArray[T any](ctx context.Context, j *json.Decoder, c chan<- T, reply *Reply, report Report) (n int, err error) {
 	// while the array contains values
 	for j.More() {
 		var o T
+		ok := true
 		// decode an array value
-		err = j.Decode(&o)
+		if report == nil {
+			err = j.Decode(&o)
+		} else {
+			ok, err = decodeItem(ctx, j, &o, n, report)
+		}
+		if err != nil {
+			return
+		}
+		if ok {
+			err = send(ctx, c, o, n, reply)
+			if err != nil {
+				return
+			}
+		}
+		n++
+	}
+	return
+}
+
+// decodeItem reads a raw value first, so that a value of a wrong shape doesn't break the array
+func decodeItem[T any](ctx context.Context, j *json.Decoder, o *T, n int, report Report) (bool, error) {
+	var raw json.RawMessage
+	err := j.Decode(&raw)
+	if err != nil {
+		return false, err
+	}
+	err = json.Unmarshal(raw, o)
+	if err == nil {
+		return true, nil
+	}
+	if n < reportedFromContext(ctx) {
+		return false, nil
+	}
+	return false, report(ctx, &ItemError{Index: n, Offset: j.InputOffset() - int64(len(raw)), Raw: raw, Err: err})
+}
+
+// send passes the n-th item on and remembers it as a page boundary
+func send[T any](ctx context.Context, c chan<- T, o T, n int, reply *Reply) error {
+	select {
+	case c <- o:
+		if reply != nil {
+			if n == 0 {
+				reply.First = o
+			}
+			reply.Last = o
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Envelope streams the array found at a dotted path of an ORDS like object, a bare array is decoded as is
+func Envelope[T any](path string) func(context.Context, io.Reader, chan<- T) (int, error) {
+	return envelope[T](path, nil)
+}
+
+// EnvelopeLenient is Envelope that reports the array values that fail to decode and goes on
+func EnvelopeLenient[T any](path string, report Report) func(context.Context, io.Reader, chan<- T) (int, error) {
+	return envelope[T](path, report)
+}
+
+func envelope[T any](path string, report Report) func(context.Context, io.Reader, chan<- T) (int, error) {
+	keys := strings.FieldsFunc(path, func(r rune) bool { return r == '.' })
+	return func(ctx context.Context, r io.Reader, c chan<- T) (n int, err error) {
+		reply, _ := ReplyFromContext(ctx)
+		j := json.NewDecoder(r)
+		t, err := j.Token()
+		if err != nil {
+			return
+		}
+		switch t {
+		case json.Delim('['):
+			n, err = decodeArray(ctx, j, c, reply, report)
+		case json.Delim('{'):
+			var found bool
+			n, found, err = decodeObject(ctx, j, keys, c, reply, report)
+			if err == nil && !found {
+				// an object without items is an error reply rather than the end of data
+				err = fmt.Errorf("%w: %s", ErrNoItems, path)
+			}
+		default:
+			err = fmt.Errorf("unexpected token %v", t)
+		}
+		if err != nil {
+			return
+		}
+		// read closing bracket
+		_, err = j.Token()
+		return
+	}
+}
+
+// decodeObject tells whether the array at the keys was found
+func decodeObject[T any](ctx context.Context, j *json.Decoder, keys []string, c chan<- T, reply *Reply, report Report) (n int, found bool, err error) {
+	for j.More() {
+		var t json.Token
+		t, err = j.Token()
 		if err != nil {
 			return
 		}
-		select {
-		case c <- o:
-			n++
-		case <-ctx.Done():
-			err = ctx.Err()
+		key, _ := t.(string)
+		var m int
+		switch {
+		case len(keys) > 0 && key == keys[0]:
+			m, found, err = decodeValue(ctx, j, keys[1:], c, reply, report)
+			n += m
+		case key == "hasMore" && reply != nil:
+			var more bool
+			err = j.Decode(&more)
+			reply.More = &more
+		case key == "links" && reply != nil:
+			var links []struct {
+				Rel  string `json:"rel"`
+				Href string `json:"href"`
+			}
+			err = j.Decode(&links)
+			for _, link := range links {
+				if link.Rel == "next" {
+					reply.Next = link.Href
+				}
+			}
+		case key == "next" && reply != nil:
+			var next json.RawMessage
+			err = j.Decode(&next)
+			if err == nil {
+				reply.Next = decodeNext(next)
+			}
+		default:
+			var skip json.RawMessage
+			err = j.Decode(&skip)
+		}
+		if err != nil {
 			return
 		}
 	}
+	return
+}
+
+func decodeValue[T any](ctx context.Context, j *json.Decoder, keys []string, c chan<- T, reply *Reply, report Report) (n int, found bool, err error) {
+	t, err := j.Token()
+	if err != nil {
+		return
+	}
+	switch {
+	case t == json.Delim('[') && len(keys) == 0:
+		found = true
+		n, err = decodeArray(ctx, j, c, reply, report)
+	case t == json.Delim('{') && len(keys) > 0:
+		n, found, err = decodeObject(ctx, j, keys, c, reply, report)
+	default:
+		err = fmt.Errorf("unexpected token %v", t)
+	}
+	if err != nil {
+		return
+	}
 	// read closing bracket
 	_, err = j.Token()
 	return
 }
+
+// decodeNext reads a next reference given as a string or as {"$ref": "..."}
+func decodeNext(raw json.RawMessage) string {
+	var next string
+	if json.Unmarshal(raw, &next) == nil {
+		return next
+	}
+	var ref struct {
+		Ref string `json:"$ref"`
+	}
+	_ = json.Unmarshal(raw, &ref)
+	return ref.Ref
+}
@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	ID int `json:"id"`
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want []item
+		more *bool
+		next string
+		err  error
+	}{
+		{
+			name: "array",
+			path: "items",
+			body: `[{"id":1},{"id":2}]`,
+			want: []item{{1}, {2}},
+		},
+		{
+			name: "ords",
+			path: "items",
+			body: `{"items":[{"id":1},{"id":2}],"hasMore":true,"limit":2,"offset":0,"links":[{"rel":"self","href":"/a"},{"rel":"next","href":"/a?offset=2"}]}`,
+			want: []item{{1}, {2}},
+			more: ptr(true),
+			next: "/a?offset=2",
+		},
+		{
+			name: "last",
+			path: "items",
+			body: `{"hasMore":false,"items":[{"id":3}]}`,
+			want: []item{{3}},
+			more: ptr(false),
+		},
+		{
+			name: "nested",
+			path: "data.rows",
+			body: `{"meta":{"x":[1,2]},"data":{"rows":[{"id":4}]},"next":{"$ref":"/b"}}`,
+			want: []item{{4}},
+			next: "/b",
+		},
+		{
+			name: "empty",
+			path: "items",
+			body: `{"items":[],"hasMore":false}`,
+			more: ptr(false),
+		},
+		{
+			name: "error",
+			path: "items",
+			body: `{"code":"ORA-1","message":"boom"}`,
+			err:  ErrNoItems,
+		},
+		{
+			name: "no path",
+			path: "",
+			body: `{"items":[{"id":1}]}`,
+			err:  ErrNoItems,
+		},
+		{
+			name: "no leaf",
+			path: "data.rows",
+			body: `{"data":{"count":0}}`,
+			err:  ErrNoItems,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reply Reply
+			c := make(chan item, 10)
+			n, err := Envelope[item](tt.path)(ContextWithReply(context.TODO(), &reply), strings.NewReader(tt.body), c)
+			close(c)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Envelope() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			var got []item
+			for o := range c {
+				got = append(got, o)
+			}
+			if n != len(tt.want) || !slices.Equal(got, tt.want) {
+				t.Errorf("Envelope() = %d %v, want %v", n, got, tt.want)
+			}
+			if (reply.More == nil) != (tt.more == nil) || reply.More != nil && *reply.More != *tt.more {
+				t.Errorf("Envelope() more = %v, want %v", reply.More, tt.more)
+			}
+			if reply.Next != tt.next {
+				t.Errorf("Envelope() next = %v, want %v", reply.Next, tt.next)
+			}
+		})
+	}
+}
+
+func TestDecodeLenient(t *testing.T) {
+	body := `[{"id":1}, {"id":"12a"},{"id":3}]`
+
+	_, err := Decode[item](context.TODO(), strings.NewReader(body), make(chan item, 10))
+	if err == nil {
+		t.Fatal("Decode() error = nil, want an error")
+	}
+
+	var errs []*ItemError
+	c := make(chan item, 10)
+	n, err := DecodeLenient[item](func(_ context.Context, e *ItemError) error {
+		errs = append(errs, e)
+		return nil
+	})(context.TODO(), strings.NewReader(body), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(c)
+
+	if n != 3 {
+		t.Errorf("DecodeLenient() n = %d, want 3", n)
+	}
+	var got []item
+	for o := range c {
+		got = append(got, o)
+	}
+	if !slices.Equal(got, []item{{1}, {3}}) {
+		t.Errorf("DecodeLenient() items = %v, want %v", got, []item{{1}, {3}})
+	}
+	if len(errs) != 1 || errs[0].Index != 1 || errs[0].Offset != 11 || string(errs[0].Raw) != `{"id":"12a"}` {
+		t.Errorf("DecodeLenient() errors = %v", errs)
+	}
+}
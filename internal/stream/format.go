@@ -0,0 +1,288 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+var ErrFormat = errors.New("unknown format")
+
+var MediaTypes = map[string][]string{
+	"json":   {"application/json"},
+	"ndjson": {"application/x-ndjson", "application/jsonl"},
+	"csv":    {"text/csv"},
+	"xml":    {"application/xml", "text/xml"},
+}
+
+type Format[T any] struct {
+	Items   string
+	Comma   rune
+	Charset string
+	Element string
+	Lenient Report
+}
+
+func (f Format[T]) Decoder(name string) (func(context.Context, io.Reader, chan<- T) (int, error), error) {
+	switch name {
+	case "", "auto":
+		return f.Auto, nil
+	case "json":
+		return envelope[T](f.Items, f.Lenient), nil
+	case "ndjson":
+		return NDJSON[T], nil
+	case "csv":
+		return CSV[T](f.Comma, f.Charset), nil
+	case "xml":
+		return XML[T](f.Element, f.Charset), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrFormat, name)
+	}
+}
+
+func (f Format[T]) Accept(name string) []string {
+	if name != "" && name != "auto" {
+		return MediaTypes[name]
+	}
+	var accept []string
+	for _, name := range []string{"json", "ndjson", "csv", "xml"} {
+		accept = append(accept, MediaTypes[name]...)
+	}
+	return accept
+}
+
+// Auto picks the decoder by the reply content type, JSON by default
+func (f Format[T]) Auto(ctx context.Context, r io.Reader, c chan<- T) (int, error) {
+	name := "json"
+	if reply, ok := ReplyFromContext(ctx); ok && reply.Header != nil {
+		mediaType, _, _ := mime.ParseMediaType(reply.Header.Get("Content-Type"))
+		for format, mediaTypes := range MediaTypes {
+			for _, t := range mediaTypes {
+				if t == mediaType {
+					name = format
+				}
+			}
+		}
+	}
+	decoder, err := f.Decoder(name)
+	if err != nil {
+		return 0, err
+	}
+	return decoder(ctx, r, c)
+}
+
+func NDJSON[T any](ctx context.Context, r io.Reader, c chan<- T) (n int, err error) {
+	reply, _ := ReplyFromContext(ctx)
+	j := json.NewDecoder(r)
+	for {
+		var o T
+		err = j.Decode(&o)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return
+		}
+		err = send(ctx, c, o, n, reply)
+		if err != nil {
+			return
+		}
+		n++
+	}
+}
+
+// CSV maps header columns to fields by db or json tags, the charset of the reply is used when none is given
+func CSV[T any](comma rune, charset string) func(context.Context, io.Reader, chan<- T) (int, error) {
+	return func(ctx context.Context, r io.Reader, c chan<- T) (n int, err error) {
+		reply, _ := ReplyFromContext(ctx)
+		r, err = decodeCharset(r, charset, reply)
+		if err != nil {
+			return
+		}
+		x := csv.NewReader(r)
+		if comma != 0 {
+			x.Comma = comma
+		}
+		x.ReuseRecord = true
+		header, err := x.Read()
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		}
+		if err != nil {
+			return
+		}
+		columns := columnFields(reflect.TypeFor[T](), header)
+		for {
+			var record []string
+			record, err = x.Read()
+			if errors.Is(err, io.EOF) {
+				return n, nil
+			}
+			if err != nil {
+				return
+			}
+			var o T
+			v := reflect.ValueOf(&o).Elem()
+			for i, value := range record {
+				if i >= len(columns) || columns[i] == nil {
+					continue
+				}
+				err = setField(v.FieldByIndex(columns[i]), value)
+				if err != nil {
+					line, _ := x.FieldPos(i)
+					return n, fmt.Errorf("line %d column %q: %w", line, header[i], err)
+				}
+			}
+			err = send(ctx, c, o, n, reply)
+			if err != nil {
+				return
+			}
+			n++
+		}
+	}
+}
+
+// XML decodes every element of the given name wherever it is nested
+func XML[T any](element, charset string) func(context.Context, io.Reader, chan<- T) (int, error) {
+	return func(ctx context.Context, r io.Reader, c chan<- T) (n int, err error) {
+		reply, _ := ReplyFromContext(ctx)
+		if charset != "" {
+			r, err = decodeCharset(r, charset, nil)
+			if err != nil {
+				return
+			}
+		}
+		x := xml.NewDecoder(r)
+		x.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+			return decodeCharset(input, label, nil)
+		}
+		for {
+			var t xml.Token
+			t, err = x.Token()
+			if errors.Is(err, io.EOF) {
+				return n, nil
+			}
+			if err != nil {
+				return
+			}
+			start, ok := t.(xml.StartElement)
+			if !ok || start.Name.Local != element {
+				continue
+			}
+			var o T
+			err = x.DecodeElement(&o, &start)
+			if err != nil {
+				return
+			}
+			err = send(ctx, c, o, n, reply)
+			if err != nil {
+				return
+			}
+			n++
+		}
+	}
+}
+
+func decodeCharset(r io.Reader, charset string, reply *Reply) (io.Reader, error) {
+	if charset == "" && reply != nil && reply.Header != nil {
+		_, params, _ := mime.ParseMediaType(reply.Header.Get("Content-Type"))
+		charset = params["charset"]
+	}
+	if charset == "" || strings.EqualFold(charset, "utf-8") {
+		// drop a byte order mark
+		b := bufio.NewReader(r)
+		if bom, _, err := b.ReadRune(); err != nil || bom != '\ufeff' {
+			_ = b.UnreadRune()
+		}
+		return b, nil
+	}
+	e, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return e.NewDecoder().Reader(r), nil
+}
+
+func columnFields(t reflect.Type, header []string) [][]int {
+	fields := map[string][]int{}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		fields[strings.ToLower(f.Name)] = f.Index
+		for _, tag := range []string{"json", "db"} {
+			name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+			if name != "" && name != "-" {
+				fields[strings.ToLower(name)] = f.Index
+			}
+		}
+	}
+	columns := make([][]int, len(header))
+	for i, name := range header {
+		columns[i] = fields[strings.ToLower(strings.TrimSpace(name))]
+	}
+	return columns
+}
+
+func setField(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if s == "" {
+		v.SetZero()
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// Comma reads a delimiter setting, semicolon by default
+func Comma(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return ';'
+	}
+	return r
+}
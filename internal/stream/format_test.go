@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type row struct {
+	ID   int    `json:"id" xml:"id"`
+	Name string `db:"name_db" json:"name" xml:"name"`
+}
+
+func TestFormat_Decoder(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      Format[row]
+		contentType string
+		body        string
+		want        []row
+	}{
+		{
+			name:   "ndjson",
+			format: Format[row]{},
+			body:   "{\"id\":1,\"name\":\"a\"}\n{\"id\":2}\n",
+			want:   []row{{1, "a"}, {2, ""}},
+		},
+		{
+			name:   "csv",
+			format: Format[row]{Comma: ';'},
+			body:   "\ufeffID;name_db;extra\n1;a;x\n2;\"b;c\";y\n",
+			want:   []row{{1, "a"}, {2, "b;c"}},
+		},
+		{
+			name:        "csv",
+			format:      Format[row]{Comma: ','},
+			contentType: "text/csv; charset=windows-1251",
+			body:        "id,name\n3,\xcf\xf0\xe8\xe2\xe5\xf2\n",
+			want:        []row{{3, "Привет"}},
+		},
+		{
+			name:   "xml",
+			format: Format[row]{Element: "item"},
+			body:   `<?xml version="1.0"?><idoc><head><id>9</id></head><items><item><id>1</id><name>a</name></item><item><id>2</id></item></items></idoc>`,
+			want:   []row{{1, "a"}, {2, ""}},
+		},
+		{
+			name:        "auto",
+			format:      Format[row]{Element: "item"},
+			contentType: "text/xml",
+			body:        `<items><item><id>5</id></item></items>`,
+			want:        []row{{5, ""}},
+		},
+		{
+			name:        "auto",
+			format:      Format[row]{Items: "items"},
+			contentType: "application/json",
+			body:        `{"items":[{"id":6}]}`,
+			want:        []row{{6, ""}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decode, err := tt.format.Decoder(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply := Reply{Header: http.Header{"Content-Type": {tt.contentType}}}
+			c := make(chan row, 10)
+			n, err := decode(ContextWithReply(context.TODO(), &reply), strings.NewReader(tt.body), c)
+			close(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []row
+			for o := range c {
+				got = append(got, o)
+			}
+			if n != len(tt.want) || !slices.Equal(got, tt.want) {
+				t.Errorf("Decode() = %d %v, want %v", n, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type Reply struct {
+	URL    url.URL
+	Status int
+	Header http.Header
+	Next   string
+	More   *bool
+	First  any
+	Last   any
+	// Throttled is a throttling status of a failed attempt retried after
+	Throttled int
+
+	Compressed   int64
+	Decompressed int64
+}
+
+type replyKey struct{}
+
+func ContextWithReply(ctx context.Context, reply *Reply) context.Context {
+	return context.WithValue(ctx, replyKey{}, reply)
+}
+
+func ReplyFromContext(ctx context.Context) (*Reply, bool) {
+	reply, ok := ctx.Value(replyKey{}).(*Reply)
+	return reply, ok
+}
+
+type reportedKey struct{}
+
+// ContextWithReported tells a lenient decoder that the first n values were reported by an earlier attempt
+func ContextWithReported(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, reportedKey{}, n)
+}
+
+func reportedFromContext(ctx context.Context) int {
+	n, _ := ctx.Value(reportedKey{}).(int)
+	return n
+}
@@ -0,0 +1,106 @@
+package sap_segmentation
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
+)
+
+const (
+	DefaultMaxInterval = time.Minute
+	// MinThrottleInterval is where a throttled loader without an interval backs off from
+	MinThrottleInterval = 100 * time.Millisecond
+)
+
+type Reply = stream.Reply
+
+type Limiter struct {
+	sync.Mutex
+	Interval time.Duration
+	Max      time.Duration
+	Current  time.Duration
+	Next     time.Time
+}
+
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.Lock()
+	at := l.Next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	l.Next = at.Add(l.Current)
+	l.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(at)):
+		return nil
+	}
+}
+
+func (l *Limiter) Update(reply *Reply) {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	after, ok := RetryAfter(reply.Header, now)
+	status := reply.Status
+	if reply.Throttled != 0 {
+		// the page got through on a retry, yet it was throttled
+		status = reply.Throttled
+	}
+	switch {
+	case Throttled(status):
+		l.Current = min(max(2*l.Current, l.Interval, MinThrottleInterval), l.Max)
+		slog.Warn("rate limit", "status", status, "retry-after", after, "interval", l.Current)
+	case ok:
+		slog.Warn("rate limit", "status", reply.Status, "retry-after", after, "interval", l.Current)
+	case l.Current > l.Interval:
+		l.Current = max(l.Interval, l.Current*4/5)
+		slog.Debug("rate limit", "interval", l.Current)
+	}
+	if ok && l.Next.Before(now.Add(after)) {
+		l.Next = now.Add(after)
+	}
+}
+
+func Throttled(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// RetryAfter reads Retry-After or an exhausted X-RateLimit-Reset
+func RetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if v := header.Get("Retry-After"); v != "" {
+		if s, err := strconv.Atoi(v); err == nil {
+			return time.Duration(s) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(0, t.Sub(now)), true
+		}
+	}
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+	s, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	switch {
+	case err != nil:
+		return 0, false
+	case s > now.Unix()/2:
+		// epoch seconds rather than a delay
+		return max(0, time.Unix(s, 0).Sub(now)), true
+	default:
+		return time.Duration(s) * time.Second, true
+	}
+}
+
+func NewLimiter(interval, maximum time.Duration) *Limiter {
+	return &Limiter{
+		Interval: interval,
+		Max:      max(interval, maximum),
+		Current:  interval,
+	}
+}
@@ -0,0 +1,110 @@
+package sap_segmentation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{name: "none", header: http.Header{}},
+		{name: "seconds", header: http.Header{"Retry-After": {"7"}}, want: 7 * time.Second, ok: true},
+		{name: "date", header: http.Header{"Retry-After": {now.Add(time.Minute).Format(http.TimeFormat)}}, want: time.Minute, ok: true},
+		{name: "remaining", header: http.Header{"X-Ratelimit-Remaining": {"1"}, "X-Ratelimit-Reset": {"5"}}},
+		{name: "reset", header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"5"}}, want: 5 * time.Second, ok: true},
+		{name: "epoch", header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {strconv.FormatInt(now.Unix()+3, 10)}}, want: 3 * time.Second, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := RetryAfter(tt.header, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("RetryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLimiter_Update(t *testing.T) {
+	l := NewLimiter(time.Second, 3*time.Second)
+	for _, want := range []time.Duration{2, 3, 3} {
+		l.Update(&Reply{Status: http.StatusTooManyRequests, Header: http.Header{}})
+		if l.Current != want*time.Second {
+			t.Errorf("Update() interval = %v, want %v", l.Current, want*time.Second)
+		}
+	}
+	for range 10 {
+		l.Update(&Reply{Status: http.StatusOK, Header: http.Header{}})
+	}
+	if l.Current != time.Second {
+		t.Errorf("Update() interval = %v, want %v", l.Current, time.Second)
+	}
+}
+
+func TestLimiter_UpdateThrottled(t *testing.T) {
+	l := NewLimiter(0, time.Second)
+	l.Update(&Reply{Status: http.StatusTooManyRequests, Header: http.Header{}})
+	if l.Current != MinThrottleInterval {
+		t.Errorf("Update() interval = %v, want %v", l.Current, MinThrottleInterval)
+	}
+	l.Update(&Reply{Status: http.StatusOK, Header: http.Header{}, Throttled: http.StatusServiceUnavailable})
+	if l.Current != 2*MinThrottleInterval {
+		t.Errorf("Update() interval = %v, want %v", l.Current, 2*MinThrottleInterval)
+	}
+}
+
+func TestLoad_Throttled(t *testing.T) {
+	var attempt int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt++
+		if attempt == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `[{"id":0}]`)
+	}))
+	defer s.Close()
+
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter, err := NewGetter("test", time.Second, stream.Decode[Object])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter := NewLimiter(0, time.Second)
+	loader, err := NewPagedLoader(limiter, NewPager(*URL, "offset", "limit"), RetryGetter[Object](Retry{
+		Attempts:  2,
+		Base:      time.Millisecond,
+		Max:       time.Millisecond,
+		Retryable: Temporary(http.StatusTooManyRequests),
+	})(getter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := loader.Load(context.TODO(), 10, make(chan Object, 10))
+	if err != nil || n != 1 {
+		t.Fatalf("Load() = %d, %v", n, err)
+	}
+	if limiter.Current != MinThrottleInterval {
+		t.Errorf("Load() interval = %v, want %v", limiter.Current, MinThrottleInterval)
+	}
+}
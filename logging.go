@@ -2,9 +2,12 @@ package sap_segmentation
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
 )
 
 type G[T Putter[T]] struct {
@@ -12,10 +15,24 @@ type G[T Putter[T]] struct {
 }
 
 func (g G[T]) Get(ctx context.Context, URL url.URL, items chan<- T) (int, error) {
+	reply, ok := stream.ReplyFromContext(ctx)
+	if !ok {
+		reply = &Reply{}
+		ctx = stream.ContextWithReply(ctx, reply)
+	}
 	n, err := g.Getter.Get(ctx, URL, items)
-	switch err {
-	case nil:
-		slog.Info(URL.Redacted(), "count", n)
+	var status *HTTPStatusError
+	switch {
+	case err == nil:
+		slog.Info(URL.Redacted(), "count", n, "compressed", reply.Compressed, "decompressed", reply.Decompressed)
+	case errors.Is(err, ErrThrottled) && errors.As(err, &status):
+		slog.Warn(URL.Redacted(), "count", n, "status", status.StatusCode, "reason", ErrThrottled, "err", err)
+	case errors.Is(err, ErrUnauthorized) && errors.As(err, &status):
+		slog.Error(URL.Redacted(), "count", n, "status", status.StatusCode, "reason", ErrUnauthorized, "err", err)
+	case errors.Is(err, ErrServer) && errors.As(err, &status):
+		slog.Error(URL.Redacted(), "count", n, "status", status.StatusCode, "reason", ErrServer, "err", err)
+	case errors.As(err, &status):
+		slog.Error(URL.Redacted(), "count", n, "status", status.StatusCode, "err", err)
 	default:
 		slog.Error(URL.Redacted(), "count", n, "err", err)
 	}
@@ -41,6 +58,17 @@ func (d D[T]) Save(ctx context.Context, item T) (T, error) {
 	return item, err
 }
 
+func (d D[T]) SaveBatch(ctx context.Context, items []T) ([]T, error) {
+	saved, err := d.Driver.SaveBatch(ctx, items)
+	for _, item := range saved {
+		slog.Debug(fmt.Sprintf("%+v", item))
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("batch of %d", len(items)), "saved", len(saved), "err", err)
+	}
+	return saved, err
+}
+
 func LogDriver[T Putter[T]](driver Driver[T]) Driver[T] {
 	return D[T]{Driver: driver}
 }
@@ -0,0 +1,164 @@
+package sap_segmentation
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
+)
+
+const namespace = "sap_segmentation"
+
+type Metrics struct {
+	Pages         prometheus.Counter
+	Items         prometheus.Counter
+	Responses     *prometheus.CounterVec
+	GetDuration   prometheus.Histogram
+	PutDuration   *prometheus.HistogramVec
+	Rows          *prometheus.CounterVec
+	BatchErrors   prometheus.Counter
+	BufferedPages prometheus.Gauge
+	BufferedItems prometheus.Gauge
+	Runs          *prometheus.CounterVec
+	LastSuccess   prometheus.Gauge
+}
+
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		Pages: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "pages_total", Help: "Pages fetched.",
+		}),
+		Items: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "items_decoded_total", Help: "Items decoded.",
+		}),
+		Responses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "http_responses_total", Help: "Source responses by status code, 0 when there is none.",
+		}, []string{"code"}),
+		GetDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "get_duration_seconds", Help: "Page fetch and decode latency.",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+		}),
+		PutDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "put_duration_seconds", Help: "Row and batch save latency.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"op"}),
+		Rows: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "rows_total", Help: "Saved rows by change, failed rows are saved one by one.",
+		}, []string{"change"}),
+		BatchErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "batch_errors_total", Help: "Failed batch saves.",
+		}),
+		BufferedPages: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "buffered_pages", Help: "Pages waiting to be saved.",
+		}),
+		BufferedItems: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "buffered_items", Help: "Decoded items of the page being saved waiting in its buffer.",
+		}),
+		Runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "runs_total", Help: "Finished import runs by status.",
+		}, []string{"status"}),
+		LastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "last_success_timestamp_seconds", Help: "Time of the last successful run.",
+		}),
+	}
+	registerer.MustRegister(m.Pages, m.Items, m.Responses, m.GetDuration, m.PutDuration,
+		m.Rows, m.BatchErrors, m.BufferedPages, m.BufferedItems, m.Runs, m.LastSuccess)
+	return m
+}
+
+func (m *Metrics) Buffer(pages, items int) {
+	m.BufferedPages.Set(float64(pages))
+	m.BufferedItems.Set(float64(items))
+}
+
+func (m *Metrics) Begin(context.Context) error {
+	return nil
+}
+
+func (m *Metrics) End(_ context.Context, _ Stats, err error) error {
+	if err != nil {
+		m.Runs.WithLabelValues("failed").Inc()
+		return nil
+	}
+	m.Runs.WithLabelValues("succeeded").Inc()
+	m.LastSuccess.SetToCurrentTime()
+	return nil
+}
+
+func (m *Metrics) rows(item any) {
+	changer, ok := item.(Changer)
+	if !ok {
+		m.Rows.WithLabelValues("saved").Inc()
+		return
+	}
+	m.Rows.WithLabelValues(changer.Changed().String()).Inc()
+}
+
+type MG[T Putter[T]] struct {
+	Getter[T]
+	*Metrics
+}
+
+func (g MG[T]) Get(ctx context.Context, URL url.URL, items chan<- T) (int, error) {
+	reply, ok := stream.ReplyFromContext(ctx)
+	if !ok {
+		reply = &Reply{}
+		ctx = stream.ContextWithReply(ctx, reply)
+	}
+	start := time.Now()
+	n, err := g.Getter.Get(ctx, URL, items)
+	g.GetDuration.Observe(time.Since(start).Seconds())
+	g.Responses.WithLabelValues(strconv.Itoa(reply.Status)).Inc()
+	g.Items.Add(float64(n))
+	if err == nil {
+		g.Pages.Inc()
+	}
+	return n, err
+}
+
+func MetricGetter[T Putter[T]](m *Metrics) func(Getter[T]) Getter[T] {
+	return func(getter Getter[T]) Getter[T] {
+		return MG[T]{Getter: getter, Metrics: m}
+	}
+}
+
+type MD[T Putter[T]] struct {
+	Driver[T]
+	*Metrics
+}
+
+func (d MD[T]) Save(ctx context.Context, item T) (T, error) {
+	start := time.Now()
+	item, err := d.Driver.Save(ctx, item)
+	d.PutDuration.WithLabelValues("row").Observe(time.Since(start).Seconds())
+	if err != nil {
+		d.Rows.WithLabelValues("failed").Inc()
+		return item, err
+	}
+	d.rows(item)
+	return item, nil
+}
+
+func (d MD[T]) SaveBatch(ctx context.Context, items []T) ([]T, error) {
+	start := time.Now()
+	saved, err := d.Driver.SaveBatch(ctx, items)
+	d.PutDuration.WithLabelValues("batch").Observe(time.Since(start).Seconds())
+	if err != nil {
+		d.BatchErrors.Inc()
+		return saved, err
+	}
+	for _, item := range saved {
+		d.rows(item)
+	}
+	return saved, nil
+}
+
+func MetricDriver[T Putter[T]](m *Metrics) func(Driver[T]) Driver[T] {
+	return func(driver Driver[T]) Driver[T] {
+		return MD[T]{Driver: driver, Metrics: m}
+	}
+}
@@ -0,0 +1,53 @@
+package sap_segmentation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+
+	importer, err := NewImporter(8, &sqlx.DB{}, newTestLoader(t, 30, func(offset int) Diffed {
+		return Diffed{ID: offset}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = importer.
+		WithGetter(MetricGetter[Diffed](m)).
+		WithDriver(DryDriver[Diffed](nil, nil), MetricDriver[Diffed](m)).
+		Import(context.TODO(), WithObserver(m), WithRecorder(Recorders(m)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		c    prometheus.Collector
+		want float64
+	}{
+		{name: "pages", c: m.Pages, want: 5},
+		{name: "items", c: m.Items, want: 30},
+		{name: "ok", c: m.Responses.WithLabelValues("200"), want: 5},
+		{name: "inserted", c: m.Rows.WithLabelValues("inserted"), want: 15},
+		{name: "unchanged", c: m.Rows.WithLabelValues("unchanged"), want: 15},
+		{name: "succeeded", c: m.Runs.WithLabelValues("succeeded"), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testutil.ToFloat64(tt.c); got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	if testutil.ToFloat64(m.LastSuccess) == 0 {
+		t.Error("last success isn't set")
+	}
+}
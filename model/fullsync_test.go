@@ -0,0 +1,106 @@
+package model_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/pshvedko/sap_segmentation"
+	"github.com/pshvedko/sap_segmentation/model"
+)
+
+func TestFullSync_Sweep(t *testing.T) {
+	name := os.Getenv("TEST_SAP_SEGMENTATION_DB")
+	if name == "" {
+		t.SkipNow()
+	}
+	db, err := sqlx.Open("pgx", name)
+	if err != nil {
+		t.FailNow()
+	}
+	defer func() { _ = db.Close() }()
+	tests := []struct {
+		name       string
+		hard       bool
+		maxPercent float64
+		err        error
+	}{
+		{name: "refuse", maxPercent: 10, err: sap_segmentation.ErrSweep},
+		{name: "soft", maxPercent: 50},
+		{name: "hard", hard: true, maxPercent: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the sweep sees the whole table, so it runs on an empty one in a transaction never committed
+			tx, err := db.Beginx()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = tx.Rollback() }()
+			ctx := sap_segmentation.ContextWithTx(context.TODO(), tx)
+			_, err = tx.Exec(`DELETE FROM segment`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys := []string{"A", "B", "C", "D"}
+			for _, key := range keys {
+				_, err = model.Segmentation{AddressSapId: key}.Put(ctx, tx)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// a quarter of the rows is missing from the run
+			run := sap_segmentation.NewRun()
+			ctx = sap_segmentation.ContextWithRun(ctx, run)
+			sync := sap_segmentation.NewFullSync(db, tt.hard, tt.maxPercent)
+			err = sync.Mark(ctx, keys[:3])
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = sync.Sweep(ctx)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Sweep() error = %v, want %v", err, tt.err)
+			}
+
+			var missing model.Segmentation
+			err = tx.Get(&missing, `SELECT * FROM segment WHERE address_sap_id = 'D'`)
+			switch {
+			case tt.err != nil:
+				if err != nil || missing.DeletedAt != nil {
+					t.Fatalf("Sweep() deleted = %v, %v, want the row left alone", missing.DeletedAt, err)
+				}
+				return
+			case tt.hard:
+				if !errors.Is(err, sql.ErrNoRows) {
+					t.Fatalf("Sweep() error = %v, want the row deleted", err)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+			if missing.DeletedAt == nil || missing.ImportRunId == nil || *missing.ImportRunId != run {
+				t.Fatalf("Sweep() deleted = %v by %v, want deleted by %s", missing.DeletedAt, missing.ImportRunId, run)
+			}
+			var live int
+			err = tx.Get(&live, `SELECT count(*) FROM segment WHERE deleted_at IS NULL`)
+			if err != nil || live != 3 {
+				t.Fatalf("Sweep() live = %d, %v, want 3", live, err)
+			}
+
+			// the soft deleted row comes back with the next run that brings it
+			ctx = sap_segmentation.ContextWithRun(ctx, sap_segmentation.NewRun())
+			back, err := model.Segmentation{AddressSapId: "D"}.Put(ctx, tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if back.DeletedAt != nil || back.Change != sap_segmentation.Updated {
+				t.Errorf("Put() = %v %v, want an updated live row", back.DeletedAt, back.Change)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type History struct {
+	Id            int64     `json:"id" db:"id"`
+	AddressSapId  string    `json:"address_sap_id" db:"address_sap_id"`
+	Operation     string    `json:"operation" db:"operation"`
+	OldAdrSegment *string   `json:"old_adr_segment,omitempty" db:"old_adr_segment"`
+	NewAdrSegment *string   `json:"new_adr_segment,omitempty" db:"new_adr_segment"`
+	OldSegmentId  *int64    `json:"old_segment_id,omitempty" db:"old_segment_id"`
+	NewSegmentId  *int64    `json:"new_segment_id,omitempty" db:"new_segment_id"`
+	ImportRunId   *string   `json:"import_run_id,omitempty" db:"import_run_id"`
+	ChangedAt     time.Time `json:"changed_at" db:"changed_at"`
+}
+
+// Histories returns the changes of an address made in [from, to), a zero time leaves the range open
+func Histories(ctx context.Context, db sqlx.QueryerContext, address string, from, to time.Time) ([]History, error) {
+	var histories []History
+	err := sqlx.SelectContext(ctx, db, &histories, `
+SELECT *
+FROM segment_history
+WHERE address_sap_id = $1
+  AND ($2::timestamptz IS NULL OR changed_at >= $2)
+  AND ($3::timestamptz IS NULL OR changed_at < $3)
+ORDER BY changed_at, id`, address, nullTime(from), nullTime(to))
+	return histories, err
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
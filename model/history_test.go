@@ -0,0 +1,44 @@
+package model_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/pshvedko/sap_segmentation"
+	"github.com/pshvedko/sap_segmentation/model"
+)
+
+func TestHistories(t *testing.T) {
+	name := os.Getenv("TEST_SAP_SEGMENTATION_DB")
+	if name == "" {
+		t.SkipNow()
+	}
+	db, err := sqlx.Open("pgx", name)
+	if err != nil {
+		t.FailNow()
+	}
+	defer func() { _ = db.Close() }()
+	ctx := sap_segmentation.ContextWithRun(context.TODO(), sap_segmentation.NewRun())
+	key := "HISTORY" + sap_segmentation.NewRun()
+	from := time.Now().Add(-time.Minute)
+	for _, segment := range []string{"1", "1", "2"} {
+		_, err = model.Segmentation{AddressSapId: key, AdrSegment: segment}.Put(ctx, db)
+		if err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	histories, err := model.Histories(ctx, db, key, from, time.Time{})
+	if err != nil {
+		t.Fatalf("Histories() error = %v", err)
+	}
+	if len(histories) != 2 || histories[0].Operation != "insert" || histories[1].Operation != "update" {
+		t.Fatalf("Histories() = %+v, want an insert and an update", histories)
+	}
+	if *histories[1].OldAdrSegment != "1" || *histories[1].NewAdrSegment != "2" {
+		t.Errorf("Histories() update = %+v, want 1 -> 2", histories[1])
+	}
+}
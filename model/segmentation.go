@@ -2,29 +2,60 @@ package model
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
+
+	"github.com/pshvedko/sap_segmentation"
 )
 
+const MaxBatchSize = 65535 / 4
+
+var ErrInvalid = errors.New("invalid segmentation")
+
 type Segmentation struct {
-	Id           int64  `json:"id,omitempty" db:"id"`
-	AddressSapId string `json:"address_sap_id,omitempty" db:"address_sap_id"`
-	AdrSegment   string `json:"adr_segment,omitempty" db:"adr_segment"`
-	SegmentId    int64  `json:"segment_id,omitempty" db:"segment_id"`
+	Id           int64      `json:"id,omitempty" db:"id" xml:"id,omitempty"`
+	AddressSapId string     `json:"address_sap_id,omitempty" db:"address_sap_id" xml:"address_sap_id,omitempty"`
+	AdrSegment   string     `json:"adr_segment,omitempty" db:"adr_segment" xml:"adr_segment,omitempty"`
+	SegmentId    int64      `json:"segment_id,omitempty" db:"segment_id" xml:"segment_id,omitempty"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty" db:"deleted_at" xml:"deleted_at,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty" db:"created_at" xml:"created_at,omitempty"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty" db:"updated_at" xml:"updated_at,omitempty"`
+	ImportRunId  *string    `json:"import_run_id,omitempty" db:"import_run_id" xml:"import_run_id,omitempty"`
+
+	Change sap_segmentation.Change `json:"-" db:"change" xml:"-"`
+}
+
+func (s Segmentation) Key() string {
+	return s.AddressSapId
+}
+
+func (s Segmentation) Validate() error {
+	switch {
+	case s.AddressSapId == "":
+		return fmt.Errorf("%w: empty address_sap_id", ErrInvalid)
+	case utf8.RuneCountInString(s.AddressSapId) > 255:
+		return fmt.Errorf("%w: address_sap_id longer than 255", ErrInvalid)
+	case utf8.RuneCountInString(s.AdrSegment) > 16:
+		return fmt.Errorf("%w: adr_segment longer than 16", ErrInvalid)
+	case s.SegmentId < 0:
+		return fmt.Errorf("%w: negative segment_id %d", ErrInvalid, s.SegmentId)
+	}
+	return nil
 }
 
 // Put comments in the code will cost from $3000 per month
-func (s Segmentation) Put(ctx context.Context, db *sqlx.DB) (Segmentation, error) {
-	row, err := db.NamedQueryContext(ctx, `
-INSERT INTO segment(address_sap_id, adr_segment, segment_id)
-VALUES (:address_sap_id, :adr_segment, :segment_id)	
-ON CONFLICT (address_sap_id) 
-	DO UPDATE SET adr_segment = excluded.adr_segment, 
-	              segment_id = excluded.segment_id
-RETURNING *`, s)
+func (s Segmentation) Put(ctx context.Context, db sqlx.ExtContext) (Segmentation, error) {
+	s = stamp(ctx, s)
+	row, err := sqlx.NamedQueryContext(ctx, db, upsert, s)
 	if err != nil {
 		return s, err
 	}
+	s.Change = sap_segmentation.Unchanged
 	if row.Next() {
 		err = row.StructScan(&s)
 	}
@@ -37,3 +68,123 @@ RETURNING *`, s)
 	}
 	return s, row.Err()
 }
+
+func (s Segmentation) PutBatch(ctx context.Context, db sqlx.ExtContext, items []Segmentation) ([]Segmentation, error) {
+	items = unique(items)
+	saved := make([]Segmentation, 0, len(items))
+	for len(items) > 0 {
+		n := min(len(items), MaxBatchSize)
+		rows, err := putBatch(ctx, db, items[:n])
+		saved = append(saved, rows...)
+		if err != nil {
+			return saved, err
+		}
+		saved = append(saved, unchanged(items[:n], rows)...)
+		items = items[n:]
+	}
+	return saved, nil
+}
+
+func (s Segmentation) Changed() sap_segmentation.Change {
+	return s.Change
+}
+
+func (s Segmentation) Diff(ctx context.Context, db sqlx.QueryerContext) (sap_segmentation.Difference[Segmentation], error) {
+	var stored Segmentation
+	err := sqlx.GetContext(ctx, db, &stored, `SELECT * FROM segment WHERE address_sap_id = $1`, s.AddressSapId)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		s.Change = sap_segmentation.Inserted
+		return sap_segmentation.Difference[Segmentation]{Change: s.Change, New: s}, nil
+	case err != nil:
+		return sap_segmentation.Difference[Segmentation]{}, err
+	}
+	s.Change = sap_segmentation.Unchanged
+	if s.AdrSegment != stored.AdrSegment || s.SegmentId != stored.SegmentId || stored.DeletedAt != nil {
+		s.Change = sap_segmentation.Updated
+	}
+	return sap_segmentation.Difference[Segmentation]{Change: s.Change, Old: &stored, New: s}, nil
+}
+
+// upsert leaves a row alone unless its values differ or it was deleted, xmax is zero for an inserted row
+const upsert = `
+INSERT INTO segment(address_sap_id, adr_segment, segment_id, import_run_id)
+VALUES (:address_sap_id, :adr_segment, :segment_id, :import_run_id)
+ON CONFLICT (address_sap_id) 
+	DO UPDATE SET adr_segment = excluded.adr_segment, 
+	              segment_id = excluded.segment_id,
+	              deleted_at = NULL,
+	              updated_at = now(),
+	              import_run_id = excluded.import_run_id
+	WHERE (segment.adr_segment, segment.segment_id) IS DISTINCT FROM (excluded.adr_segment, excluded.segment_id)
+	   OR segment.deleted_at IS NOT NULL
+RETURNING *, CASE WHEN xmax = 0 THEN 1 ELSE 2 END AS change`
+
+func putBatch(ctx context.Context, db sqlx.ExtContext, items []Segmentation) ([]Segmentation, error) {
+	stamped := make([]Segmentation, len(items))
+	for n, item := range items {
+		stamped[n] = stamp(ctx, item)
+	}
+	row, err := sqlx.NamedQueryContext(ctx, db, upsert, stamped)
+	if err != nil {
+		return nil, err
+	}
+	saved := make([]Segmentation, 0, len(items))
+	for row.Next() {
+		var s Segmentation
+		err = row.StructScan(&s)
+		if err != nil {
+			break
+		}
+		saved = append(saved, s)
+	}
+	err2 := row.Close()
+	if err2 != nil {
+		return saved, err2
+	}
+	if err != nil {
+		return saved, err
+	}
+	return saved, row.Err()
+}
+
+func stamp(ctx context.Context, s Segmentation) Segmentation {
+	if run := sap_segmentation.RunFromContext(ctx); run != "" {
+		s.ImportRunId = &run
+	}
+	return s
+}
+
+// unchanged returns the items the upsert didn't return
+func unchanged(items, saved []Segmentation) []Segmentation {
+	seen := make(map[string]bool, len(saved))
+	for _, s := range saved {
+		seen[s.AddressSapId] = true
+	}
+	var same []Segmentation
+	for _, item := range items {
+		if !seen[item.AddressSapId] {
+			item.Change = sap_segmentation.Unchanged
+			same = append(same, item)
+		}
+	}
+	return same
+}
+
+// unique keeps the last item of every address, a multi-row upsert can't touch the same row twice
+func unique(items []Segmentation) []Segmentation {
+	last := make(map[string]int, len(items))
+	for n, item := range items {
+		last[item.AddressSapId] = n
+	}
+	if len(last) == len(items) {
+		return items
+	}
+	uniq := make([]Segmentation, 0, len(last))
+	for n, item := range items {
+		if last[item.AddressSapId] == n {
+			uniq = append(uniq, item)
+		}
+	}
+	return uniq
+}
@@ -2,11 +2,14 @@ package model_test
 
 import (
 	"context"
+	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/jmoiron/sqlx"
 
+	"github.com/pshvedko/sap_segmentation"
 	"github.com/pshvedko/sap_segmentation/model"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -75,3 +78,85 @@ func TestSegmentation_Put(t *testing.T) {
 		})
 	}
 }
+
+func TestSegmentation_PutBatch(t *testing.T) {
+	name := os.Getenv("TEST_SAP_SEGMENTATION_DB")
+	if name == "" {
+		t.SkipNow()
+	}
+	db, err := sqlx.Open("pgx", name)
+	if err != nil {
+		t.FailNow()
+	}
+	defer func() { _ = db.Close() }()
+	ctx := context.TODO()
+	items := []model.Segmentation{
+		{AddressSapId: "BATCH1", AdrSegment: "1", SegmentId: 1},
+		{AddressSapId: "BATCH2", AdrSegment: "2", SegmentId: 2},
+		{AddressSapId: "BATCH1", AdrSegment: "3", SegmentId: 3},
+	}
+	saved, err := model.Segmentation{}.PutBatch(ctx, db, items)
+	if err != nil {
+		t.Fatalf("PutBatch() error = %v", err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("PutBatch() saved = %v, want 2 rows", saved)
+	}
+	for _, s := range saved {
+		if s.AddressSapId == "BATCH1" && s.SegmentId != 3 {
+			t.Errorf("PutBatch() saved = %+v, want the last duplicate", s)
+		}
+	}
+}
+
+func TestSegmentation_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    model.Segmentation
+		want error
+	}{
+		{name: "ok", s: model.Segmentation{AddressSapId: "ЁЖ", AdrSegment: strings.Repeat("Ж", 16)}},
+		{name: "empty", s: model.Segmentation{AdrSegment: "X"}, want: model.ErrInvalid},
+		{name: "long address", s: model.Segmentation{AddressSapId: strings.Repeat("X", 256)}, want: model.ErrInvalid},
+		{name: "long segment", s: model.Segmentation{AddressSapId: "X", AdrSegment: strings.Repeat("X", 17)}, want: model.ErrInvalid},
+		{name: "negative", s: model.Segmentation{AddressSapId: "X", SegmentId: -1}, want: model.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.s.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentation_Changed(t *testing.T) {
+	name := os.Getenv("TEST_SAP_SEGMENTATION_DB")
+	if name == "" {
+		t.SkipNow()
+	}
+	db, err := sqlx.Open("pgx", name)
+	if err != nil {
+		t.FailNow()
+	}
+	defer func() { _ = db.Close() }()
+	ctx := sap_segmentation.ContextWithRun(context.TODO(), sap_segmentation.NewRun())
+	key := "CHANGE" + sap_segmentation.NewRun()
+	tests := []struct {
+		segment string
+		want    sap_segmentation.Change
+	}{
+		{segment: "1", want: sap_segmentation.Inserted},
+		{segment: "1", want: sap_segmentation.Unchanged},
+		{segment: "2", want: sap_segmentation.Updated},
+	}
+	for _, tt := range tests {
+		s, err := model.Segmentation{AddressSapId: key, AdrSegment: tt.segment}.Put(ctx, db)
+		if err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		if s.Changed() != tt.want {
+			t.Errorf("Put() change = %v, want %v", s.Changed(), tt.want)
+		}
+	}
+}
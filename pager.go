@@ -0,0 +1,230 @@
+package sap_segmentation
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrForeignLink = errors.New("next link leaves the source")
+
+// turn lets a pager that learns from replies hand out one page at a time
+type turn chan struct{}
+
+func newTurn() turn {
+	t := make(turn, 1)
+	t <- struct{}{}
+	return t
+}
+
+// lastPage tells whether the reply says there are no more pages
+func lastPage(reply *Reply) bool {
+	return reply.More != nil && !*reply.More
+}
+
+type Keyset struct {
+	url.URL
+	After string
+	Limit string
+	Key   string
+	Done  bool
+	turn
+}
+
+func (p *Keyset) Page(size int) (url.URL, error) {
+	<-p.turn
+	if p.Done {
+		p.turn <- struct{}{}
+		return url.URL{}, ErrLastPage
+	}
+	u := p.URL
+	q := u.Query()
+	if p.Key != "" {
+		q.Set(p.After, p.Key)
+	}
+	q.Set(p.Limit, strconv.Itoa(size))
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+func (p *Keyset) Follow(reply *Reply) error {
+	defer func() { p.turn <- struct{}{} }()
+	if key, ok := reply.Last.(Keyer); ok {
+		p.Key = key.Key()
+	}
+	p.Done = lastPage(reply)
+	return nil
+}
+
+func (p *Keyset) Seek(int) {
+	p.Key, p.Done = "", false
+}
+
+func (p *Keyset) Tell() int {
+	return -1
+}
+
+func NewKeysetPager(URL url.URL, after, limit string) Pager {
+	return &Keyset{
+		URL:   URL,
+		After: after,
+		Limit: limit,
+		turn:  newTurn(),
+	}
+}
+
+type Cursor struct {
+	url.URL
+	Param  string
+	Limit  string
+	Header string
+	Token  string
+	Done   bool
+	turn
+}
+
+func (p *Cursor) Page(size int) (url.URL, error) {
+	<-p.turn
+	if p.Done {
+		p.turn <- struct{}{}
+		return url.URL{}, ErrLastPage
+	}
+	u := p.URL
+	q := u.Query()
+	if p.Token != "" {
+		q.Set(p.Param, p.Token)
+	}
+	q.Set(p.Limit, strconv.Itoa(size))
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+func (p *Cursor) Follow(reply *Reply) error {
+	defer func() { p.turn <- struct{}{} }()
+	p.Token = reply.Next
+	if p.Header != "" {
+		p.Token = reply.Header.Get(p.Header)
+	}
+	p.Done = p.Token == "" || lastPage(reply)
+	return nil
+}
+
+func (p *Cursor) Seek(int) {
+	p.Token, p.Done = "", false
+}
+
+func (p *Cursor) Tell() int {
+	return -1
+}
+
+func NewCursorPager(URL url.URL, param, limit, header string) Pager {
+	return &Cursor{
+		URL:    URL,
+		Param:  param,
+		Limit:  limit,
+		Header: header,
+		turn:   newTurn(),
+	}
+}
+
+type Link struct {
+	url.URL
+	Limit string
+	Next  *url.URL
+	Done  bool
+	turn
+}
+
+func (p *Link) Page(size int) (url.URL, error) {
+	<-p.turn
+	if p.Done {
+		p.turn <- struct{}{}
+		return url.URL{}, ErrLastPage
+	}
+	if p.Next != nil {
+		return *p.Next, nil
+	}
+	u := p.URL
+	q := u.Query()
+	q.Set(p.Limit, strconv.Itoa(size))
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+func (p *Link) Follow(reply *Reply) error {
+	defer func() { p.turn <- struct{}{} }()
+	next := reply.Next
+	if link, ok := ParseLink(reply.Header.Values("Link"), "next"); ok {
+		next = link
+	}
+	if next == "" || lastPage(reply) {
+		p.Done = true
+		return nil
+	}
+	base := p.URL
+	if p.Next != nil {
+		base = *p.Next
+	}
+	u, err := base.Parse(next)
+	if err != nil {
+		p.Done = true
+		return err
+	}
+	// the credentials of the source never go to another host
+	if u.Scheme != p.URL.Scheme || u.Host != p.URL.Host {
+		p.Done = true
+		return fmt.Errorf("%w: %s", ErrForeignLink, u.Redacted())
+	}
+	u.User = p.URL.User
+	p.Next = u
+	return nil
+}
+
+func (p *Link) Seek(int) {
+	p.Next, p.Done = nil, false
+}
+
+func (p *Link) Tell() int {
+	return -1
+}
+
+func NewLinkPager(URL url.URL, limit string) Pager {
+	return &Link{
+		URL:   URL,
+		Limit: limit,
+		turn:  newTurn(),
+	}
+}
+
+// ParseLink finds the target of a relation in RFC 5988 Link header values
+func ParseLink(values []string, rel string) (string, bool) {
+	for _, v := range values {
+		for {
+			start := strings.IndexByte(v, '<')
+			end := strings.IndexByte(v, '>')
+			if start < 0 || end < start {
+				break
+			}
+			target := v[start+1 : end]
+			v = v[end+1:]
+			params := v
+			if next := strings.IndexByte(v, '<'); next >= 0 {
+				params = v[:next]
+			}
+			for _, param := range strings.Split(params, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+				value = strings.Trim(strings.TrimRight(strings.TrimSpace(value), ","), `"`)
+				if slices.Contains(strings.Fields(value), rel) {
+					return target, true
+				}
+			}
+		}
+	}
+	return "", false
+}
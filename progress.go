@@ -0,0 +1,40 @@
+package sap_segmentation
+
+import "sync/atomic"
+
+// Progress is kept by a running import, it is safe to read while the import goes on
+type Progress struct {
+	stats  Stats
+	offset int64
+}
+
+func (p *Progress) page(offset int, changes Changes, rejected, errors int64) {
+	atomic.AddInt64(&p.stats.Pages, 1)
+	p.stats.Changes.Add(changes)
+	atomic.StoreInt64(&p.stats.Rejected, rejected)
+	atomic.StoreInt64(&p.stats.Errors, errors)
+	atomic.StoreInt64(&p.offset, int64(offset))
+}
+
+func (p *Progress) Stats() Stats {
+	return Stats{
+		Pages: atomic.LoadInt64(&p.stats.Pages),
+		Changes: Changes{
+			Inserted:  atomic.LoadInt64(&p.stats.Inserted),
+			Updated:   atomic.LoadInt64(&p.stats.Updated),
+			Unchanged: atomic.LoadInt64(&p.stats.Unchanged),
+		},
+		Rejected: atomic.LoadInt64(&p.stats.Rejected),
+		Errors:   atomic.LoadInt64(&p.stats.Errors),
+	}
+}
+
+// Offset is the source offset after the last saved page, -1 for pagers without offsets
+func (p *Progress) Offset() int64 {
+	return atomic.LoadInt64(&p.offset)
+}
+
+// Observer samples how many pages wait for saving and how many items the page being saved holds
+type Observer interface {
+	Buffer(pages, items int)
+}
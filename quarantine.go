@@ -0,0 +1,139 @@
+package sap_segmentation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrTooManyRejects = errors.New("too many rejects")
+
+type Validator interface {
+	Validate() error
+}
+
+// Rejecter takes the source value of an item that doesn't decode, or the item encoded again when it doesn't save
+type Rejecter interface {
+	Reject(ctx context.Context, item []byte, offset int, cause error) error
+}
+
+type Quarantine struct {
+	*sqlx.DB
+}
+
+func (q Quarantine) Reject(ctx context.Context, item []byte, offset int, cause error) error {
+	_, err := Ext(ctx, q.DB).ExecContext(ctx, `
+INSERT INTO segment_rejected(run_id, source_offset, item, error)
+VALUES ($1, $2, $3, $4)`, RunFromContext(ctx), sql.NullInt64{Int64: int64(offset), Valid: offset >= 0}, string(item), cause.Error())
+	return err
+}
+
+func NewQuarantine(db *sqlx.DB) Quarantine {
+	return Quarantine{DB: db}
+}
+
+// Savepoint runs f so that its failure doesn't abort the transaction from the context
+func Savepoint(ctx context.Context, f func(context.Context) error) error {
+	tx, ok := TxFromContext(ctx)
+	if !ok {
+		return f(ctx)
+	}
+	_, err := tx.ExecContext(ctx, `SAVEPOINT item`)
+	if err != nil {
+		return err
+	}
+	err = f(ctx)
+	if err != nil {
+		_, _ = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT item`)
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT item`)
+	return err
+}
+
+type quarantineKey struct{}
+
+type startKey struct{}
+
+type skipKey struct{}
+
+// skips are the indices of the values of a page that never reach its items, in order
+type skips struct {
+	sync.Mutex
+	index []int
+}
+
+func (s *skips) add(n int) {
+	s.Lock()
+	defer s.Unlock()
+	s.index = append(s.index, n)
+}
+
+// source tells the index of the n-th item of a page among the values of the page
+func (s *skips) source(n int) int {
+	s.Lock()
+	defer s.Unlock()
+	for _, k := range s.index {
+		if k > n {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// Reject quarantines a value skipped at the index of the current page, without a quarantine the cause is returned
+func Reject(ctx context.Context, item any, index int, cause error) error {
+	if s, ok := ctx.Value(skipKey{}).(*skips); ok {
+		s.add(index)
+	}
+	q, ok := ctx.Value(quarantineKey{}).(*quarantine)
+	if !ok {
+		return cause
+	}
+	offset := -1
+	if start, ok := ctx.Value(startKey{}).(int); ok && start >= 0 {
+		offset = start + index
+	}
+	return q.reject(ctx, item, offset, cause)
+}
+
+type quarantine struct {
+	Rejecter
+	Limit  int
+	count  atomic.Int64
+	errors atomic.Int64
+}
+
+func (q *quarantine) reject(ctx context.Context, item any, offset int, cause error) error {
+	if !q.enabled() {
+		return cause
+	}
+	// a raw message is kept as is
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	err = q.Reject(ctx, b, offset, cause)
+	if err != nil {
+		return err
+	}
+	slog.Warn("reject", "offset", offset, "err", cause)
+	q.errors.Add(1)
+	n := q.count.Add(1)
+	if q.Limit > 0 && n > int64(q.Limit) {
+		return fmt.Errorf("%w: %d", ErrTooManyRejects, n)
+	}
+	return nil
+}
+
+func (q *quarantine) enabled() bool {
+	return q.Rejecter != nil
+}
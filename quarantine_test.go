@@ -0,0 +1,155 @@
+package sap_segmentation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
+)
+
+var (
+	errBroken  = errors.New("broken")
+	errInvalid = errors.New("invalid")
+)
+
+type Checked struct {
+	ID int `json:"id"`
+}
+
+func (c Checked) Validate() error {
+	if c.ID%5 == 0 {
+		return errInvalid
+	}
+	return nil
+}
+
+func (c Checked) Put(context.Context, sqlx.ExtContext) (Checked, error) {
+	if c.ID%7 == 0 {
+		return c, errBroken
+	}
+	return c, nil
+}
+
+type Rejects []int
+
+func (r *Rejects) Reject(_ context.Context, _ []byte, offset int, _ error) error {
+	*r = append(*r, offset)
+	return nil
+}
+
+func TestImport_Quarantine(t *testing.T) {
+	s := httptest.NewServer(stream.NewHandler(30, func(offset int) Checked {
+		return Checked{ID: offset}
+	}))
+	defer s.Close()
+
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter, err := NewGetter("test", 0, stream.Decode[Checked])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader, err := NewLoader(0, *URL, "offset", "limit", getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importer, err := NewImporter(4, &sqlx.DB{}, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = importer.Import(context.TODO())
+	if !errors.Is(err, errInvalid) {
+		t.Errorf("Import() error = %v, want %v", err, errInvalid)
+	}
+
+	var rejects Rejects
+	var progress Progress
+	loader.Seek(0)
+	err = importer.Import(context.TODO(), WithQuarantine(&rejects, 0), WithProgress(&progress))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (Rejects{0, 5, 7, 10, 15, 14, 20, 21, 25, 28}); !slices.Equal(rejects, want) {
+		t.Errorf("Import() rejects = %v, want %v", rejects, want)
+	}
+
+	// four batches failed before their rows were saved one by one
+	if stats := progress.Stats(); stats.Rejected != 10 || stats.Errors != 14 {
+		t.Errorf("Import() rejected = %d, errors = %d, want 10 and 14", stats.Rejected, stats.Errors)
+	}
+
+	rejects = nil
+	loader.Seek(0)
+	err = importer.Import(context.TODO(), WithQuarantine(&rejects, 3))
+	if !errors.Is(err, ErrTooManyRejects) {
+		t.Errorf("Import() error = %v, want %v", err, ErrTooManyRejects)
+	}
+}
+
+type Items map[int]string
+
+func (r Items) Reject(_ context.Context, item []byte, offset int, _ error) error {
+	r[offset] = string(item)
+	return nil
+}
+
+func TestImport_Lenient(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("offset") != "0" {
+			_, _ = fmt.Fprint(w, `[]`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `[{"id":1},{"id":"x"},{"id":5},{"id":6}]`)
+	}))
+	defer s.Close()
+
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter, err := NewGetter("test", 0, stream.DecodeLenient[Checked](func(ctx context.Context, e *stream.ItemError) error {
+		return Reject(ctx, e.Raw, e.Index, e)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader, err := NewLoader(0, *URL, "offset", "limit", getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importer, err := NewImporter(4, &sqlx.DB{}, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the item after a skipped value is rejected at its index among the values
+	items := Items{}
+	err = importer.Import(context.TODO(), WithQuarantine(items, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (Items{1: `{"id":"x"}`, 2: `{"id":5}`}); !maps.Equal(items, want) {
+		t.Errorf("Import() rejects = %v, want %v", items, want)
+	}
+}
@@ -0,0 +1,125 @@
+package sap_segmentation
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Stats struct {
+	Pages int64
+	Changes
+	Rejected int64
+	// Errors are the ones the run got over, failed batches saved again row by row and rejected rows
+	Errors int64
+}
+
+type Recorder interface {
+	Begin(context.Context) error
+	End(context.Context, Stats, error) error
+}
+
+type recorders []Recorder
+
+func (r recorders) Begin(ctx context.Context) error {
+	for _, record := range r {
+		err := record.Begin(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r recorders) End(ctx context.Context, stats Stats, cause error) error {
+	var errs []error
+	for _, record := range r {
+		errs = append(errs, record.End(ctx, stats, cause))
+	}
+	return errors.Join(errs...)
+}
+
+// Recorders records a run with every recorder
+func Recorders(r ...Recorder) Recorder {
+	return recorders(r)
+}
+
+type ImportRun struct {
+	Id         string     `json:"id" db:"id"`
+	Source     string     `json:"source" db:"source"`
+	Status     string     `json:"status" db:"status"`
+	StartedAt  time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	Pages      int64      `json:"pages" db:"pages"`
+	Inserted   int64      `json:"inserted" db:"inserted"`
+	Updated    int64      `json:"updated" db:"updated"`
+	Unchanged  int64      `json:"unchanged" db:"unchanged"`
+	Rejected   int64      `json:"rejected" db:"rejected"`
+	Error      *string    `json:"error,omitempty" db:"error"`
+}
+
+func (r ImportRun) Duration() time.Duration {
+	if r.FinishedAt == nil {
+		return time.Since(r.StartedAt)
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// Registry keeps a row of every import run in import_run
+type Registry struct {
+	*sqlx.DB
+	Source string
+}
+
+func (r Registry) Begin(ctx context.Context) error {
+	_, err := r.ExecContext(ctx, `
+INSERT INTO import_run(id, source, status, started_at)
+VALUES ($1, $2, 'running', now())`, RunFromContext(ctx), r.Source)
+	return err
+}
+
+func (r Registry) End(ctx context.Context, stats Stats, cause error) error {
+	status := "succeeded"
+	var reason *string
+	if cause != nil {
+		status = "failed"
+		reason = new(string)
+		*reason = cause.Error()
+	}
+	_, err := r.ExecContext(ctx, `
+UPDATE import_run
+SET status      = $2,
+    finished_at = now(),
+    pages       = $3,
+    inserted    = $4,
+    updated     = $5,
+    unchanged   = $6,
+    rejected    = $7,
+    error       = $8
+WHERE id = $1`, RunFromContext(ctx), status, stats.Pages,
+		stats.Inserted, stats.Updated, stats.Unchanged, stats.Rejected, reason)
+	return err
+}
+
+func (r Registry) List(ctx context.Context, limit int) ([]ImportRun, error) {
+	var runs []ImportRun
+	err := r.SelectContext(ctx, &runs, `SELECT * FROM import_run ORDER BY started_at DESC LIMIT $1`, limit)
+	return runs, err
+}
+
+func (r Registry) Find(ctx context.Context, id string) (ImportRun, error) {
+	var run ImportRun
+	err := r.GetContext(ctx, &run, `SELECT * FROM import_run WHERE id = $1`, id)
+	return run, err
+}
+
+func NewRegistry(db *sqlx.DB, URL url.URL) Registry {
+	URL.User = nil
+	return Registry{
+		DB:     db,
+		Source: URL.String(),
+	}
+}
@@ -0,0 +1,116 @@
+package sap_segmentation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Record struct {
+	run   string
+	stats Stats
+	err   error
+}
+
+func (r *Record) Begin(ctx context.Context) error {
+	r.run = RunFromContext(ctx)
+	return nil
+}
+
+func (r *Record) End(ctx context.Context, stats Stats, err error) error {
+	if r.run != RunFromContext(ctx) {
+		r.run = ""
+	}
+	r.stats, r.err = stats, err
+	return nil
+}
+
+func TestImport_Recorder(t *testing.T) {
+	importer, err := NewImporter(8, &sqlx.DB{}, newTestLoader(t, 30, func(offset int) Checked {
+		return Checked{ID: offset + 1}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record Record
+	var rejects Rejects
+	err = importer.Import(context.TODO(), WithRun("test"), WithRecorder(&record), WithQuarantine(&rejects, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.run != "test" || record.err != nil || record.stats.Pages != 4 || record.stats.Rejected != int64(len(rejects)) {
+		t.Errorf("Import() record = %+v, want run test with 4 pages and %d rejects", record, len(rejects))
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	db := newTestDB(t)
+	// the source is kept without the credentials
+	source := url.URL{Scheme: "test", Host: t.Name()}
+	registry := NewRegistry(db, url.URL{Scheme: "test", User: url.User("user"), Host: t.Name()})
+
+	tests := []struct {
+		name   string
+		stats  Stats
+		cause  error
+		status string
+	}{
+		{name: "succeeded", stats: Stats{Pages: 4, Changes: Changes{Inserted: 1, Updated: 2, Unchanged: 3}, Rejected: 5}, status: "succeeded"},
+		{name: "failed", stats: Stats{Pages: 1}, cause: errBroken, status: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := ContextWithRun(context.TODO(), NewRun())
+			t.Cleanup(func() { _, _ = db.Exec(`DELETE FROM import_run WHERE id = $1`, RunFromContext(ctx)) })
+
+			err := registry.Begin(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			run, err := registry.Find(ctx, RunFromContext(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.Status != "running" || run.FinishedAt != nil || run.Source != source.String() {
+				t.Errorf("Begin() run = %+v, want a running one", run)
+			}
+
+			err = registry.End(ctx, tt.stats, tt.cause)
+			if err != nil {
+				t.Fatal(err)
+			}
+			run, err = registry.Find(ctx, RunFromContext(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.Status != tt.status || run.FinishedAt == nil || run.Pages != tt.stats.Pages || run.Rejected != tt.stats.Rejected ||
+				run.Inserted != tt.stats.Inserted || run.Updated != tt.stats.Updated || run.Unchanged != tt.stats.Unchanged {
+				t.Errorf("End() run = %+v, want %s with %+v", run, tt.status, tt.stats)
+			}
+			if (run.Error == nil) != (tt.cause == nil) || tt.cause != nil && *run.Error != tt.cause.Error() {
+				t.Errorf("End() error = %v, want %v", run.Error, tt.cause)
+			}
+
+			runs, err := registry.List(ctx, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.ContainsFunc(runs, func(r ImportRun) bool { return r.Id == run.Id }) {
+				t.Errorf("List() = %v, want %s in it", runs, run.Id)
+			}
+		})
+	}
+
+	// the admin api answers 404 to it
+	_, err := registry.Find(context.TODO(), NewRun())
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Find() error = %v, want %v", err, sql.ErrNoRows)
+	}
+}
@@ -0,0 +1,123 @@
+package sap_segmentation
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
+)
+
+type Retry struct {
+	Attempts  int
+	Base      time.Duration
+	Max       time.Duration
+	Jitter    float64
+	Retryable func(error) bool
+}
+
+func (r Retry) Delay(attempt int) time.Duration {
+	d := r.Base
+	for ; attempt > 1 && d < r.Max; attempt-- {
+		d *= 2
+	}
+	d = min(d, r.Max)
+	if r.Jitter > 0 && d > 0 {
+		d -= time.Duration(rand.Float64() * r.Jitter * float64(d))
+	}
+	return d
+}
+
+func Temporary(codes ...int) func(error) bool {
+	return func(err error) bool {
+		var status *HTTPStatusError
+		if errors.As(err, &status) {
+			return slices.Contains(codes, status.StatusCode)
+		}
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return true
+		}
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, syscall.EPIPE) ||
+			errors.Is(err, io.ErrUnexpectedEOF)
+	}
+}
+
+type R[T Putter[T]] struct {
+	Getter[T]
+	Retry
+}
+
+func (r R[T]) Get(ctx context.Context, URL url.URL, items chan<- T) (int, error) {
+	var count, sent int
+	for attempt := 1; ; attempt++ {
+		// values counted by a failed attempt were reported already
+		n, err := r.get(stream.ContextWithReported(ctx, count), URL, items, &sent)
+		count = max(count, n)
+		if err == nil {
+			return count, nil
+		}
+		if attempt >= r.Attempts || ctx.Err() != nil || r.Retryable == nil || !r.Retryable(err) {
+			return count, err
+		}
+		delay := r.Delay(attempt)
+		var status *HTTPStatusError
+		if errors.As(err, &status) {
+			reply, ok := stream.ReplyFromContext(ctx)
+			if ok && Throttled(status.StatusCode) {
+				reply.Throttled = status.StatusCode
+			}
+			after, ok := RetryAfter(status.Header, time.Now())
+			if ok {
+				delay = max(delay, after)
+			}
+		}
+		slog.Warn(URL.Redacted(), "attempt", attempt, "delay", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return count, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// get skips the items previous attempts sent and counts the ones it sends, a count of values
+// may differ from the items sent as a lenient decoder doesn't send the values it reports
+func (r R[T]) get(ctx context.Context, URL url.URL, items chan<- T, sent *int) (int, error) {
+	skip := *sent
+	c := make(chan T)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for item := range c {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			select {
+			case items <- item:
+				*sent++
+			case <-ctx.Done():
+			}
+		}
+	}()
+	n, err := r.Getter.Get(ctx, URL, c)
+	close(c)
+	<-done
+	return n, err
+}
+
+func RetryGetter[T Putter[T]](retry Retry) func(Getter[T]) Getter[T] {
+	return func(getter Getter[T]) Getter[T] {
+		return R[T]{Getter: getter, Retry: retry}
+	}
+}
@@ -0,0 +1,131 @@
+package sap_segmentation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
+)
+
+func TestRetryGetter(t *testing.T) {
+	var attempt int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt++
+		w.Header().Set("Content-Type", "application/json")
+		switch attempt {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			// the body breaks after two items
+			w.Header().Set("Content-Length", "100")
+			_, _ = fmt.Fprint(w, `[{"id":0},{"id":1},`)
+		default:
+			_, _ = fmt.Fprint(w, `[{"id":0},{"id":1},{"id":2},{"id":3}]`)
+		}
+	}))
+	defer s.Close()
+
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter, err := NewGetter("test", time.Second, stream.Decode[Object])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter = RetryGetter[Object](Retry{
+		Attempts:  3,
+		Base:      time.Millisecond,
+		Max:       time.Millisecond,
+		Retryable: Temporary(http.StatusBadGateway),
+	})(getter)
+
+	c := make(chan Object, 10)
+	n, err := getter.Get(context.TODO(), *URL, c)
+	close(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Object
+	for o := range c {
+		got = append(got, o)
+	}
+
+	if want := []Object{{0}, {1}, {2}, {3}}; n != len(want) || !slices.Equal(got, want) {
+		t.Errorf("Get() = %d %v, want %v", n, got, want)
+	}
+}
+
+func TestRetryGetter_Lenient(t *testing.T) {
+	var attempt int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt++
+		w.Header().Set("Content-Type", "application/json")
+		if attempt == 1 {
+			// the body breaks after a bad value and a good one
+			w.Header().Set("Content-Length", "100")
+			_, _ = fmt.Fprint(w, `[{"id":"x"},{"id":1},`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `[{"id":"x"},{"id":1},{"id":2}]`)
+	}))
+	defer s.Close()
+
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported []int
+	getter, err := NewGetter("test", time.Second, stream.DecodeLenient[Object](func(_ context.Context, e *stream.ItemError) error {
+		reported = append(reported, e.Index)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter = RetryGetter[Object](Retry{
+		Attempts:  2,
+		Base:      time.Millisecond,
+		Max:       time.Millisecond,
+		Retryable: Temporary(),
+	})(getter)
+
+	c := make(chan Object, 10)
+	n, err := getter.Get(context.TODO(), *URL, c)
+	close(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Object
+	for o := range c {
+		got = append(got, o)
+	}
+
+	if want := []Object{{1}, {2}}; n != 3 || !slices.Equal(got, want) {
+		t.Errorf("Get() = %d %v, want 3 %v", n, got, want)
+	}
+	if !slices.Equal(reported, []int{0}) {
+		t.Errorf("Get() reported = %v, want [0]", reported)
+	}
+}
+
+func TestRetry_Delay(t *testing.T) {
+	r := Retry{Base: 100 * time.Millisecond, Max: time.Second}
+	for n, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if got := r.Delay(n + 1); got != want*time.Millisecond {
+			t.Errorf("Delay(%d) = %v, want %v", n+1, got, want*time.Millisecond)
+		}
+	}
+}
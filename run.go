@@ -0,0 +1,24 @@
+package sap_segmentation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type runKey struct{}
+
+func ContextWithRun(ctx context.Context, run string) context.Context {
+	return context.WithValue(ctx, runKey{}, run)
+}
+
+func RunFromContext(ctx context.Context) string {
+	run, _ := ctx.Value(runKey{}).(string)
+	return run
+}
+
+func NewRun() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -3,22 +3,46 @@ package sap_segmentation
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pshvedko/sap_segmentation/internal/stream"
 )
 
 type Putter[T any] interface {
-	Put(context.Context, *sqlx.DB) (T, error)
+	Put(context.Context, sqlx.ExtContext) (T, error)
+}
+
+type Keyer interface {
+	Key() string
+}
+
+type BatchPutter[T any] interface {
+	PutBatch(context.Context, sqlx.ExtContext, []T) ([]T, error)
 }
 
 type Driver[T Putter[T]] interface {
 	Loader[T]
 	Save(context.Context, T) (T, error)
+	SaveBatch(context.Context, []T) ([]T, error)
+	Transaction(context.Context, func(context.Context) error) error
 	UseLoader(...func(Loader[T]) Loader[T])
 }
 
@@ -34,7 +58,26 @@ func (d *Drive[T]) UseLoader(wrappers ...func(Loader[T]) Loader[T]) {
 }
 
 func (d *Drive[T]) Save(ctx context.Context, item T) (T, error) {
-	return item.Put(ctx, d.DB)
+	return item.Put(ctx, Ext(ctx, d.DB))
+}
+
+func (d *Drive[T]) SaveBatch(ctx context.Context, items []T) ([]T, error) {
+	var zero T
+	if p, ok := any(zero).(BatchPutter[T]); ok {
+		return p.PutBatch(ctx, Ext(ctx, d.DB), items)
+	}
+	for n, item := range items {
+		item, err := d.Save(ctx, item)
+		if err != nil {
+			return items[:n], err
+		}
+		items[n] = item
+	}
+	return items, nil
+}
+
+func (d *Drive[T]) Transaction(ctx context.Context, f func(context.Context) error) error {
+	return Transaction(ctx, d.DB, f)
 }
 
 func NewDriver[T Putter[T]](db *sqlx.DB, loader Loader[T]) (Driver[T], error) {
@@ -57,7 +100,9 @@ type Getter[T Putter[T]] interface {
 type Get[T Putter[T]] struct {
 	Decoder[T]
 	http.Client
-	UserAgent string
+	UserAgent   string
+	Accept      []string
+	Compression bool
 }
 
 func (g *Get[T]) Get(ctx context.Context, URL url.URL, items chan<- T) (int, error) {
@@ -69,8 +114,73 @@ func (g *Get[T]) Get(ctx context.Context, URL url.URL, items chan<- T) (int, err
 	if err != nil {
 		return 0, err
 	}
-	defer func() { _ = res.Body.Close() }()
-	return g.Decode(ctx, res.Body, items)
+	raw := res.Body
+	defer func() { _ = raw.Close() }()
+	reply, ok := stream.ReplyFromContext(ctx)
+	if ok {
+		reply.Status = res.StatusCode
+		reply.Header = res.Header
+	}
+	wire := &counter{Reader: raw}
+	// a failed status is told before an encoding it may come with
+	err = g.CheckStatus(res, wire)
+	if err != nil {
+		return 0, err
+	}
+	body, err := Decompress(res.Header.Get("Content-Encoding"), wire)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = body.Close() }()
+	size := &counter{Reader: body}
+	err = g.CheckType(res, size)
+	if err != nil {
+		return 0, err
+	}
+	dctx, span := tracer().Start(ctx, "decode",
+		trace.WithAttributes(attribute.String("http.response.content_type", res.Header.Get("Content-Type"))))
+	n, err := g.Decode(dctx, size, items)
+	span.SetAttributes(attribute.Int("items", n), attribute.Int64("bytes", size.n))
+	finish(span, err)
+	if ok {
+		reply.Compressed = wire.n
+		reply.Decompressed = size.n
+	}
+	return n, err
+}
+
+// CheckStatus fails a response out of 2xx, the body snippet is decompressed when its encoding is known
+func (g *Get[T]) CheckStatus(res *http.Response, r io.Reader) error {
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return nil
+	}
+	body, err := Decompress(res.Header.Get("Content-Encoding"), r)
+	if err == nil {
+		defer func() { _ = body.Close() }()
+		r = body
+	}
+	return &HTTPStatusError{
+		StatusCode: res.StatusCode,
+		URL:        res.Request.URL.Redacted(),
+		Header:     res.Header,
+		Body:       Snippet(r),
+	}
+}
+
+func (g *Get[T]) CheckType(res *http.Response, r io.Reader) error {
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" || len(g.Accept) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !slices.Contains(g.Accept, mediaType) {
+		return &ContentTypeError{
+			ContentType: contentType,
+			URL:         res.Request.URL.Redacted(),
+			Body:        Snippet(r),
+		}
+	}
+	return nil
 }
 
 func (g *Get[T]) NewRequestWithContext(ctx context.Context, URL string) (*http.Request, error) {
@@ -80,39 +190,132 @@ func (g *Get[T]) NewRequestWithContext(ctx context.Context, URL string) (*http.R
 	}
 	r.Header.Set("Connection", "keep-alive")
 	r.Header.Set("User-Agent", g.UserAgent)
+	if len(g.Accept) > 0 {
+		r.Header.Set("Accept", strings.Join(g.Accept, ", "))
+	}
+	if g.Compression {
+		r.Header.Set("Accept-Encoding", Encodings)
+	} else {
+		r.Header.Set("Accept-Encoding", "identity")
+	}
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(r.Header))
 	return r, nil
 
 }
 
 func NewGetter[T Putter[T]](agent string, timeout time.Duration, decoder Decoder[T]) (Getter[T], error) {
 	return &Get[T]{
-		Client:    http.Client{Timeout: timeout},
-		Decoder:   decoder,
-		UserAgent: agent,
+		Client:      http.Client{Timeout: timeout},
+		Decoder:     decoder,
+		UserAgent:   agent,
+		Accept:      []string{"application/json"},
+		Compression: true,
 	}, nil
 }
 
+var ErrLastPage = errors.New("last page")
+
 type Pager interface {
 	Page(int) (url.URL, error)
+	Follow(*Reply) error
+	Seek(int)
+	Tell() int
 }
 
 type Page struct {
 	url.URL
-	Offset string
-	Limit  string
-	Start  int
+	Offset  string
+	Limit   string
+	Start   int
+	Base    int
+	Pages   bool
+	Overlap bool
+	Done    bool
+	sync.Mutex
+	bounds map[int][2]string
 }
 
 func (p *Page) Page(size int) (url.URL, error) {
+	p.Lock()
+	done := p.Done
+	p.Unlock()
+	if done {
+		return url.URL{}, ErrLastPage
+	}
+	offset := p.Base + p.Start
+	if p.Pages && size > 0 {
+		offset = p.Base + p.Start/size
+	}
 	u := p.URL
 	q := u.Query()
-	q.Set(p.Offset, strconv.Itoa(p.Start))
+	q.Set(p.Offset, strconv.Itoa(offset))
 	q.Set(p.Limit, strconv.Itoa(size))
 	u.RawQuery = q.Encode()
 	p.Start += size
 	return u, nil
 }
 
+// Follow warns when neighbour pages share a boundary key, the offset is probably off by one
+func (p *Page) Follow(reply *Reply) error {
+	if lastPage(reply) {
+		p.Lock()
+		p.Done = true
+		p.Unlock()
+	}
+	if !p.Overlap {
+		return nil
+	}
+	first, ok := reply.First.(Keyer)
+	if !ok {
+		return nil
+	}
+	last, ok := reply.Last.(Keyer)
+	if !ok {
+		return nil
+	}
+	q := reply.URL.Query()
+	offset, err := strconv.Atoi(q.Get(p.Offset))
+	if err != nil {
+		return nil
+	}
+	step := 1
+	if !p.Pages {
+		step, err = strconv.Atoi(q.Get(p.Limit))
+		if err != nil || step < 1 {
+			return nil
+		}
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.bounds == nil {
+		p.bounds = map[int][2]string{}
+	}
+	p.bounds[offset] = [2]string{first.Key(), last.Key()}
+	if prev, ok := p.bounds[offset-step]; ok && prev[1] == first.Key() {
+		slog.Warn("overlap", p.Offset, offset, "key", first.Key())
+	}
+	if next, ok := p.bounds[offset+step]; ok && next[0] == last.Key() {
+		slog.Warn("overlap", p.Offset, offset+step, "key", last.Key())
+	}
+	for n := range p.bounds {
+		if n < offset-64*step {
+			delete(p.bounds, n)
+		}
+	}
+	return nil
+}
+
+func (p *Page) Seek(offset int) {
+	p.Lock()
+	p.Done = false
+	p.Unlock()
+	p.Start = offset
+}
+
+func (p *Page) Tell() int {
+	return p.Start
+}
+
 func NewPager(URL url.URL, offset string, limit string) Pager {
 	return &Page{
 		URL:    URL,
@@ -123,14 +326,15 @@ func NewPager(URL url.URL, offset string, limit string) Pager {
 }
 
 type Loader[T Putter[T]] interface {
+	Pager
 	Load(context.Context, int, chan<- T) (int, error)
+	Fetch(context.Context, url.URL, chan<- T) (int, error)
 	UseGetter(...func(Getter[T]) Getter[T])
 }
 
 type Load[T Putter[T]] struct {
 	Getter[T]
-	time.Duration
-	time.Time
+	*Limiter
 	Pager
 }
 
@@ -142,27 +346,108 @@ func (l *Load[T]) UseGetter(wrappers ...func(Getter[T]) Getter[T]) {
 
 func (l *Load[T]) Load(ctx context.Context, size int, items chan<- T) (int, error) {
 	URL, err := l.Page(size)
+	if errors.Is(err, ErrLastPage) {
+		return 0, nil
+	}
 	if err != nil {
 		return 0, err
 	}
-	select {
-	case <-ctx.Done():
-		return 0, ctx.Err()
-	case l.Time = <-time.After(l.Duration + time.Until(l.Time)):
-		return l.Get(ctx, URL, items)
+	return l.Fetch(ctx, URL, items)
+}
+
+func (l *Load[T]) Fetch(ctx context.Context, URL url.URL, items chan<- T) (n int, err error) {
+	ctx, span := tracer().Start(ctx, "page", trace.WithAttributes(attribute.String("url.full", URL.Redacted())))
+	if start, ok := ctx.Value(startKey{}).(int); ok && start >= 0 {
+		span.SetAttributes(attribute.Int("offset", start))
+	}
+	defer func() {
+		span.SetAttributes(attribute.Int("items", n))
+		finish(span, err)
+	}()
+	reply := Reply{URL: URL}
+	n, err = l.fetch(stream.ContextWithReply(ctx, &reply), URL, items)
+	if reply.Status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", reply.Status))
+		l.Update(&reply)
+	}
+	// every page is followed, even a failed one, for the pager to move on
+	err2 := l.Follow(&reply)
+	if err != nil {
+		return n, err
 	}
+	return n, err2
+}
+
+func (l *Load[T]) fetch(ctx context.Context, URL url.URL, items chan<- T) (int, error) {
+	err := l.Wait(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return l.Get(ctx, URL, items)
 }
 
 func NewLoader[T Putter[T]](interval time.Duration, URL url.URL, offset, limit string, getter Getter[T]) (Loader[T], error) {
+	return NewPagedLoader(NewLimiter(interval, DefaultMaxInterval), NewPager(URL, offset, limit), getter)
+}
+
+func NewPagedLoader[T Putter[T]](limiter *Limiter, pager Pager, getter Getter[T]) (Loader[T], error) {
 	return &Load[T]{
-		Pager:    NewPager(URL, offset, limit),
-		Getter:   getter,
-		Duration: interval,
+		Pager:   pager,
+		Getter:  getter,
+		Limiter: limiter,
 	}, nil
 }
 
+var ErrAtomicity = errors.New("invalid atomicity")
+
+type Atomicity int
+
+const (
+	AtomicRow Atomicity = iota
+	AtomicPage
+	AtomicRun
+)
+
+func (a Atomicity) String() string {
+	switch a {
+	case AtomicRow:
+		return "row"
+	case AtomicPage:
+		return "page"
+	case AtomicRun:
+		return "run"
+	default:
+		return fmt.Sprintf("Atomicity(%d)", int(a))
+	}
+}
+
+func (a *Atomicity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "", "row":
+		*a = AtomicRow
+	case "page":
+		*a = AtomicPage
+	case "run":
+		*a = AtomicRun
+	default:
+		return fmt.Errorf("%w: %s", ErrAtomicity, text)
+	}
+	return nil
+}
+
 type Options struct {
-	Size int
+	Size        int
+	Concurrency int
+	Workers     int
+	Atomicity   Atomicity
+	Checkpoint  Checkpointer
+	Run         string
+	Reject      Rejecter
+	MaxRejects  int
+	Sweep       Sweeper
+	Record      Recorder
+	Progress    *Progress
+	Observer    Observer
 }
 
 type OptionFunc func(*Options)
@@ -179,6 +464,67 @@ func WithBufferSize(size int) OptionFunc {
 	}
 }
 
+func WithConcurrency(n int) OptionFunc {
+	return func(o *Options) {
+		o.Concurrency = n
+	}
+}
+
+func WithWorkers(n int) OptionFunc {
+	return func(o *Options) {
+		o.Workers = n
+	}
+}
+
+func WithAtomicity(atomicity Atomicity) OptionFunc {
+	return func(o *Options) {
+		o.Atomicity = atomicity
+	}
+}
+
+func WithCheckpoint(checkpoint Checkpointer) OptionFunc {
+	return func(o *Options) {
+		o.Checkpoint = checkpoint
+	}
+}
+
+func WithQuarantine(reject Rejecter, limit int) OptionFunc {
+	return func(o *Options) {
+		o.Reject = reject
+		o.MaxRejects = limit
+	}
+}
+
+func WithSweep(sweep Sweeper) OptionFunc {
+	return func(o *Options) {
+		o.Sweep = sweep
+	}
+}
+
+func WithRecorder(record Recorder) OptionFunc {
+	return func(o *Options) {
+		o.Record = record
+	}
+}
+
+func WithProgress(progress *Progress) OptionFunc {
+	return func(o *Options) {
+		o.Progress = progress
+	}
+}
+
+func WithObserver(observer Observer) OptionFunc {
+	return func(o *Options) {
+		o.Observer = observer
+	}
+}
+
+func WithRun(run string) OptionFunc {
+	return func(o *Options) {
+		o.Run = run
+	}
+}
+
 type Importer[T Putter[T]] interface {
 	Import(context.Context, ...Option) error
 	WithLoader(...func(Loader[T]) Loader[T]) Importer[T]
@@ -215,13 +561,57 @@ func (i *Import[T]) UseDriver(wrappers ...func(Driver[T]) Driver[T]) {
 	}
 }
 
-func (i *Import[T]) Import(ctx context.Context, options ...Option) error {
+type chunk[T Putter[T]] struct {
+	Items  chan T
+	Count  int
+	Start  int
+	Offset int
+	Err    error
+	skips
+}
+
+type entry[T Putter[T]] struct {
+	Item   T
+	Offset int
+	saving *saving[T]
+}
+
+func (i *Import[T]) Import(ctx context.Context, options ...Option) (err error) {
 	var o Options
 	for _, option := range options {
 		option.Apply(&o)
 	}
 
-	c := make(chan T, o.Size)
+	if o.Run == "" {
+		o.Run = NewRun()
+	}
+
+	var zero T
+	if _, ok := any(zero).(Keyer); !ok {
+		o.Workers = 1
+	}
+	_, changer := any(zero).(Changer)
+
+	if o.Workers > 1 && o.Atomicity != AtomicRow {
+		return fmt.Errorf("%w: %s with %d workers", ErrAtomicity, o.Atomicity, o.Workers)
+	}
+
+	ctx = ContextWithRun(ctx, o.Run)
+
+	ctx, span := tracer().Start(ctx, "import", trace.WithAttributes(attribute.String("run", o.Run)))
+	defer func() { finish(span, err) }()
+
+	q := &quarantine{Rejecter: o.Reject, Limit: o.MaxRejects}
+	ctx = context.WithValue(ctx, quarantineKey{}, q)
+
+	if o.Record != nil {
+		err := o.Record.Begin(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	c := make(chan *chunk[T], max(1, o.Concurrency))
 	e := make(chan error, 1)
 
 	defer func() {
@@ -232,26 +622,446 @@ func (i *Import[T]) Import(ctx context.Context, options ...Option) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	go func(ctx context.Context, c chan<- T, e chan<- error) {
+	go func(ctx context.Context, c chan<- *chunk[T], e chan<- error) {
 		defer close(c)
 		defer close(e)
-		for {
-			n, err := i.Load(ctx, i.Size, c)
-			if err != nil || n == 0 {
-				e <- err
+		e <- i.load(ctx, c, o)
+	}(ctx, c, e)
+
+	progress := o.Progress
+	if progress == nil {
+		progress = &Progress{}
+	}
+
+	err = i.atomic(ctx, o.Atomicity == AtomicRun, func(ctx context.Context) error {
+		w := i.pool(o.Workers, q)
+		defer w.close()
+		// the pages are saved while the next ones are dispatched, they are completed in order
+		var flight []*saving[T]
+		complete := func(ctx context.Context) error {
+			s := flight[0]
+			flight = flight[1:]
+			err := s.wait()
+			if err != nil || s.Count == 0 {
+				return err
+			}
+			if s.Offset >= 0 && o.Checkpoint != nil {
+				err = o.Checkpoint.Checkpoint(ctx, s.Offset)
+				if err != nil {
+					return err
+				}
+			}
+			offset := -1
+			if s.Start >= 0 {
+				offset = s.Start + s.Count
+			}
+			progress.page(offset, s.changes, q.count.Load(), q.errors.Load())
+			if changer {
+				slog.Info("page", "offset", s.Start, "count", s.Count, "changes", &s.changes)
+			}
+			return nil
+		}
+		for p := range c {
+			if o.Observer != nil {
+				o.Observer.Buffer(len(c), len(p.Items))
+			}
+			err := i.atomic(ctx, o.Atomicity == AtomicPage, func(ctx context.Context) error {
+				s, err := w.dispatch(ctx, p)
+				flight = append(flight, s)
+				if err != nil {
+					// the workers are done with the page before its transaction ends
+					_ = s.wait()
+					return err
+				}
+				// a transaction is not shared with the workers, so a page is completed in it before the next one
+				for len(flight) > 0 && (o.Atomicity != AtomicRow || len(flight) > max(1, o.Concurrency) || flight[0].ready()) {
+					err = complete(ctx)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if p.Count == 0 || p.Err != nil {
 				break
 			}
 		}
-	}(ctx, c, e)
+		for len(flight) > 0 {
+			err := complete(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		err := <-e
+		if changer {
+			stats := progress.Stats()
+			slog.Info("run", "run", o.Run, "pages", stats.Pages, "changes", &stats.Changes)
+		}
+		if err != nil {
+			return err
+		}
+		switch n := q.count.Load(); {
+		case o.Sweep == nil:
+		case n > 0:
+			// rejected rows are never marked as seen, a sweep would delete them
+			slog.Warn("sweep skipped", "rejects", n)
+		default:
+			err = o.Sweep.Sweep(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		if o.Checkpoint == nil {
+			return nil
+		}
+		// a complete run leaves nothing to resume from
+		return o.Checkpoint.Clear(ctx)
+	})
+
+	if o.Sweep != nil {
+		// a failed, cancelled or unswept run leaves no keys behind
+		err2 := o.Sweep.Forget(context.WithoutCancel(ctx))
+		if err == nil {
+			err = err2
+		}
+	}
+
+	stats := progress.Stats()
+	stats.Rejected = q.count.Load()
+	stats.Errors = q.errors.Load()
+	span.SetAttributes(attribute.Int64("pages", stats.Pages), attribute.Int64("rejected", stats.Rejected))
+
+	if o.Record != nil {
+		// the run is recorded even when the import is cancelled
+		err2 := o.Record.End(context.WithoutCancel(ctx), stats, err)
+		if err == nil {
+			err = err2
+		}
+	}
+
+	return err
+}
+
+// load fetches pages concurrently and delivers them in order, the first empty page cancels the ones after it
+func (i *Import[T]) load(ctx context.Context, c chan<- *chunk[T], o Options) error {
+	var (
+		g       sync.WaitGroup
+		m       sync.Mutex
+		last    = -1
+		cause   error
+		cancels = map[int]context.CancelFunc{}
+		stop    = make(chan struct{})
+		s       = make(chan struct{}, max(1, o.Concurrency))
+	)
+
+	end := func(k int, e error) {
+		m.Lock()
+		defer m.Unlock()
+		if last >= 0 && last < k {
+			return
+		}
+		if last < 0 {
+			close(stop)
+		}
+		last, cause = k, e
+		for n, cancel := range cancels {
+			if n > k {
+				cancel()
+			}
+		}
+	}
+
+	for k := 0; ; k++ {
+		select {
+		case s <- struct{}{}:
+		case <-stop:
+		case <-ctx.Done():
+			end(k, ctx.Err())
+		}
+		select {
+		case <-stop:
+			g.Wait()
+			return cause
+		default:
+		}
+
+		offset := i.Tell()
+		URL, err := i.Page(i.Size)
+		if err != nil {
+			if errors.Is(err, ErrLastPage) {
+				err = nil
+			}
+			<-s
+			end(k, err)
+			continue
+		}
+
+		p := &chunk[T]{Items: make(chan T, o.Size), Start: offset, Offset: offset}
+		select {
+		case c <- p:
+		case <-stop:
+			<-s
+			continue
+		case <-ctx.Done():
+			<-s
+			end(k, ctx.Err())
+			continue
+		}
+
+		pageCtx := context.WithValue(context.WithValue(ctx, startKey{}, offset), skipKey{}, &p.skips)
+		pageCtx, cancel := context.WithCancel(pageCtx)
+		m.Lock()
+		cancels[k] = cancel
+		m.Unlock()
+
+		g.Add(1)
+		go func(ctx context.Context, k int, URL url.URL, next int) {
+			defer g.Done()
+			p.Count, p.Err = i.Fetch(ctx, URL, p.Items)
+			// a partial page is fetched again on resume
+			if p.Count >= i.Size {
+				p.Offset = next
+			}
+			close(p.Items)
+			m.Lock()
+			delete(cancels, k)
+			m.Unlock()
+			cancel()
+			if p.Err != nil || p.Count == 0 {
+				end(k, p.Err)
+			}
+			<-s
+		}(pageCtx, k, URL, i.Tell())
+	}
+}
 
-	for item := range c {
-		_, err := i.Save(ctx, item)
+func (i *Import[T]) atomic(ctx context.Context, ok bool, f func(context.Context) error) error {
+	if ok {
+		return i.Transaction(ctx, f)
+	}
+	return f(ctx)
+}
+
+// pool saves the items of every page of a run, an item goes to the worker of its key
+type pool[T Putter[T]] struct {
+	shards []chan entry[T]
+	g      sync.WaitGroup
+	failed atomic.Bool
+}
+
+func (i *Import[T]) pool(workers int, q *quarantine) *pool[T] {
+	w := &pool[T]{shards: make([]chan entry[T], max(1, workers))}
+	for n := range w.shards {
+		w.shards[n] = make(chan entry[T], i.Size)
+		w.g.Add(1)
+		go func() {
+			defer w.g.Done()
+			i.work(w.shards[n], q, &w.failed)
+		}()
+	}
+	return w
+}
+
+// dispatch hands the items of a page to the workers, the page is done when every item is saved or rejected
+func (w *pool[T]) dispatch(ctx context.Context, p *chunk[T]) (*saving[T], error) {
+	s := &saving[T]{chunk: p, ctx: ctx, sent: make(chan struct{}), done: make(chan struct{})}
+	s.left.Store(1)
+	defer s.finish(1, nil)
+	defer close(s.sent)
+	var n int
+	for item := range p.Items {
+		var shard uint32
+		if len(w.shards) > 1 {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(any(item).(Keyer).Key()))
+			shard = h.Sum32() % uint32(len(w.shards))
+		}
+		e := entry[T]{Item: item, Offset: -1, saving: s}
+		if p.Start >= 0 {
+			e.Offset = p.Start + p.source(n)
+		}
+		n++
+		s.left.Add(1)
+		select {
+		case w.shards[shard] <- e:
+		case <-ctx.Done():
+			s.finish(1, ctx.Err())
+			return s, ctx.Err()
+		}
+	}
+	return s, nil
+}
+
+func (w *pool[T]) close() {
+	for _, shard := range w.shards {
+		close(shard)
+	}
+	w.g.Wait()
+}
+
+// saving is a page given to the workers
+type saving[T Putter[T]] struct {
+	*chunk[T]
+	ctx     context.Context
+	changes Changes
+	left    atomic.Int64
+	sent    chan struct{}
+	done    chan struct{}
+	m       sync.Mutex
+	err     error
+}
+
+func (s *saving[T]) finish(n int, err error) {
+	if err != nil {
+		s.m.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.m.Unlock()
+	}
+	if s.left.Add(-int64(n)) == 0 {
+		close(s.done)
+	}
+}
+
+func (s *saving[T]) ready() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait returns the first error of the saved items or of the fetch of the page
+func (s *saving[T]) wait() error {
+	<-s.done
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.Err
+}
+
+// work saves the items of a shard in batches of one page, a batch is flushed when it is full or its page is dispatched,
+// after a failure the items are let through unsaved
+func (i *Import[T]) work(entries <-chan entry[T], q *quarantine, failed *atomic.Bool) {
+	batch := make([]entry[T], 0, i.Size)
+	flush := func() {
+		s := batch[0].saving
+		var err error
+		if !failed.Load() {
+			err = i.flush(s.ctx, batch, q, &s.changes)
+		}
+		if err != nil {
+			failed.Store(true)
+		}
+		s.finish(len(batch), err)
+		batch = batch[:0]
+	}
+	for {
+		var e entry[T]
+		var ok bool
+		select {
+		case e, ok = <-entries:
+		default:
+			if len(batch) == 0 {
+				e, ok = <-entries
+				break
+			}
+			select {
+			case e, ok = <-entries:
+			case <-batch[0].saving.sent:
+				// nothing more of the page is coming
+				flush()
+				continue
+			}
+		}
+		if !ok {
+			if len(batch) > 0 {
+				flush()
+			}
+			return
+		}
+		if len(batch) > 0 && batch[0].saving != e.saving {
+			flush()
+		}
+		v, ok := any(e.Item).(Validator)
+		if ok && !failed.Load() {
+			err := v.Validate()
+			if err != nil {
+				err = q.reject(e.saving.ctx, e.Item, e.Offset, err)
+				if err != nil {
+					failed.Store(true)
+				}
+				e.saving.finish(1, err)
+				continue
+			}
+		}
+		batch = append(batch, e)
+		if len(batch) == i.Size {
+			flush()
+		}
+	}
+}
+
+// flush saves the batch, with a quarantine a failed batch is saved again row by row and the failed rows are rejected
+func (i *Import[T]) flush(ctx context.Context, batch []entry[T], q *quarantine, changes *Changes) error {
+	items := make([]T, len(batch))
+	for n, e := range batch {
+		items[n] = e.Item
+	}
+
+	if !q.enabled() {
+		saved, err := i.SaveBatch(ctx, items)
+		if err != nil {
+			return err
+		}
+		for _, item := range saved {
+			changes.Count(item)
+		}
+		return nil
+	}
+
+	err := Savepoint(ctx, func(ctx context.Context) error {
+		saved, err := i.SaveBatch(ctx, items)
+		if err == nil {
+			for _, item := range saved {
+				changes.Count(item)
+			}
+		}
+		return err
+	})
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	q.errors.Add(1)
+
+	for _, e := range batch {
+		err = Savepoint(ctx, func(ctx context.Context) error {
+			saved, err := i.Save(ctx, e.Item)
+			if err == nil {
+				changes.Count(saved)
+			}
+			return err
+		})
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		err = q.reject(ctx, e.Item, e.Offset, err)
 		if err != nil {
 			return err
 		}
 	}
 
-	return <-e
+	return nil
 }
 
 func New[T Putter[T]](size int, driver Driver[T]) (Importer[T], error) {
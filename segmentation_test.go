@@ -2,12 +2,21 @@ package sap_segmentation
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/kelseyhightower/envconfig"
+	"io"
 	"log/slog"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
 
 	"github.com/pshvedko/sap_segmentation/internal/config"
 	"github.com/pshvedko/sap_segmentation/internal/stream"
@@ -17,11 +26,31 @@ type Object struct {
 	ID int `json:"id"`
 }
 
-func (o Object) Put(context.Context, *sqlx.DB) (Object, error) {
+func (o Object) Put(context.Context, sqlx.ExtContext) (Object, error) {
 	_, err := fmt.Print(o)
 	return o, err
 }
 
+type Keyed struct {
+	ID int `json:"id"`
+}
+
+var saved = struct {
+	sync.Mutex
+	keys map[string][]int
+}{keys: map[string][]int{}}
+
+func (k Keyed) Key() string {
+	return strconv.Itoa(k.ID % 3)
+}
+
+func (k Keyed) Put(context.Context, sqlx.ExtContext) (Keyed, error) {
+	saved.Lock()
+	defer saved.Unlock()
+	saved.keys[k.Key()] = append(saved.keys[k.Key()], k.ID)
+	return k, nil
+}
+
 func ExampleNewImporter() {
 	h := stream.NewHandlerWithAuthorization(30, "Basic MTox", func(offset int) Object {
 		return Object{ID: offset}
@@ -76,3 +105,349 @@ func ExampleNewImporter() {
 	//
 	// {0}{1}{2}{3}{4}{5}{6}{7}{8}{9}{10}{11}{12}{13}{14}{15}{16}{17}{18}{19}{20}{21}{22}{23}{24}{25}{26}{27}{28}{29}
 }
+
+type Offsets []int
+
+func (o *Offsets) Checkpoint(_ context.Context, offset int) error {
+	*o = append(*o, offset)
+	return nil
+}
+
+// Clear is written down as a checkpoint at 0
+func (o *Offsets) Clear(context.Context) error {
+	*o = append(*o, 0)
+	return nil
+}
+
+func TestImport_Checkpoint(t *testing.T) {
+	s := httptest.NewServer(stream.NewHandler(30, func(offset int) Object {
+		return Object{ID: offset}
+	}))
+	defer s.Close()
+
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter, err := NewGetter("test", 0, stream.Decode[Object])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader, err := NewLoader(0, *URL, "offset", "limit", getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader.Seek(2)
+
+	importer, err := NewImporter(8, &sqlx.DB{}, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var offsets Offsets
+	err = importer.Import(context.TODO(), WithCheckpoint(&offsets))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (Offsets{10, 18, 26, 26, 0}); !slices.Equal(offsets, want) {
+		t.Errorf("Import() checkpoints = %v, want %v", offsets, want)
+	}
+}
+
+func TestGet_Check(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		encoding    string
+		body        string
+		want        error
+	}{
+		{name: "ok", status: http.StatusOK, contentType: "application/json; charset=utf-8", body: "[]"},
+		{name: "unauthorized", status: http.StatusUnauthorized, contentType: "application/json", want: ErrUnauthorized},
+		{name: "throttled", status: http.StatusTooManyRequests, contentType: "text/plain", want: ErrThrottled},
+		{name: "server", status: http.StatusBadGateway, contentType: "text/html", body: "<html>", want: ErrServer},
+		{name: "html", status: http.StatusOK, contentType: "text/html", body: "<html>", want: &ContentTypeError{}},
+		{name: "encoding", status: http.StatusServiceUnavailable, contentType: "text/plain", encoding: "br", body: "busy", want: ErrServer},
+		{name: "unknown", status: http.StatusOK, contentType: "application/json", encoding: "br", body: "[]", want: ErrEncoding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprint(w, tt.body)
+			}))
+			defer s.Close()
+			URL, err := url.Parse(s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			getter, err := NewGetter("test", 0, stream.Decode[Object])
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = getter.Get(context.TODO(), *URL, make(chan Object))
+			var contentType *ContentTypeError
+			switch want := tt.want.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("Get() error = %v", err)
+				}
+			case *ContentTypeError:
+				if !errors.As(err, &contentType) {
+					t.Errorf("Get() error = %v, want %T", err, want)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Errorf("Get() error = %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+type closing struct {
+	http.RoundTripper
+	closed []*bool
+}
+
+func (c *closing) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := c.RoundTripper.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	body := &closed{ReadCloser: res.Body}
+	c.closed = append(c.closed, &body.closed)
+	res.Body = body
+	return res, nil
+}
+
+type closed struct {
+	io.ReadCloser
+	closed bool
+}
+
+func (c *closed) Close() error {
+	c.closed = true
+	return c.ReadCloser.Close()
+}
+
+func TestGet_Close(t *testing.T) {
+	s := httptest.NewServer(stream.NewHandler(10, func(offset int) Object {
+		return Object{ID: offset}
+	}))
+	defer s.Close()
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	URL.RawQuery = "offset=0&limit=10"
+	c := &closing{RoundTripper: http.DefaultTransport}
+	getter := &Get[Object]{Decoder: stream.Decode[Object], Client: http.Client{Transport: c}}
+	n, err := getter.Get(context.TODO(), *URL, make(chan Object, 10))
+	if err != nil || n != 10 {
+		t.Fatalf("Get() = %d, %v", n, err)
+	}
+	if len(c.closed) != 1 || !*c.closed[0] {
+		t.Error("Get() left the body open")
+	}
+}
+
+func ExampleWithConcurrency() {
+	h := stream.NewHandler(30, func(offset int) Object {
+		return Object{ID: offset}
+	})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// later pages answer first
+		offset, _ := strconv.Atoi(r.FormValue("offset"))
+		time.Sleep(time.Duration(40-offset) * time.Millisecond)
+		h.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	URL, _ := url.Parse(s.URL)
+
+	getter, err := NewGetter("test", 0, stream.Decode[Object])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	loader, err := NewLoader(0, *URL, "offset", "limit", getter)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	importer, err := NewImporter(4, &sqlx.DB{}, loader)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = importer.Import(context.TODO(), WithConcurrency(4))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// Output:
+	//
+	// {0}{1}{2}{3}{4}{5}{6}{7}{8}{9}{10}{11}{12}{13}{14}{15}{16}{17}{18}{19}{20}{21}{22}{23}{24}{25}{26}{27}{28}{29}
+}
+
+func TestImport_Workers(t *testing.T) {
+	s := httptest.NewServer(stream.NewHandler(30, func(offset int) Keyed {
+		return Keyed{ID: offset}
+	}))
+	defer s.Close()
+
+	URL, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter, err := NewGetter("test", 0, stream.Decode[Keyed])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader, err := NewLoader(0, *URL, "offset", "limit", getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importer, err := NewImporter(2, &sqlx.DB{}, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the workers save the pages of the whole run, the checkpoints still come in order
+	var offsets Offsets
+	err = importer.Import(context.TODO(), WithWorkers(3), WithConcurrency(2), WithCheckpoint(&offsets))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Offsets{0}
+	for offset := 30; offset > 0; offset -= 2 {
+		want = slices.Insert(want, 0, offset)
+	}
+	if !slices.Equal(offsets, want) {
+		t.Errorf("Import() checkpoints = %v, want %v", offsets, want)
+	}
+
+	if len(saved.keys) != 3 {
+		t.Fatalf("Import() keys = %v, want 3", saved.keys)
+	}
+	for key, ids := range saved.keys {
+		if len(ids) != 10 || !slices.IsSorted(ids) {
+			t.Errorf("Import() key %s = %v, want 10 ordered ids", key, ids)
+		}
+	}
+
+	err = importer.Import(context.TODO(), WithWorkers(3), WithAtomicity(AtomicPage))
+	if !errors.Is(err, ErrAtomicity) {
+		t.Errorf("Import() error = %v, want %v", err, ErrAtomicity)
+	}
+}
+
+// Overlaps keeps the offsets of the overlap warnings
+type Overlaps []int64
+
+func (o *Overlaps) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (o *Overlaps) Handle(_ context.Context, r slog.Record) error {
+	if r.Message != "overlap" {
+		return nil
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "o" {
+			*o = append(*o, a.Value.Int64())
+		}
+		return true
+	})
+	return nil
+}
+
+func (o *Overlaps) WithAttrs([]slog.Attr) slog.Handler {
+	return o
+}
+
+func (o *Overlaps) WithGroup(string) slog.Handler {
+	return o
+}
+
+func TestPage_Follow(t *testing.T) {
+	type reply struct {
+		offset, first, last int
+	}
+	tests := []struct {
+		name    string
+		pages   bool
+		replies []reply
+		want    Overlaps
+	}{
+		{name: "rows", replies: []reply{{0, 0, 4}, {5, 4, 8}}, want: Overlaps{5}},
+		{name: "rows reversed", replies: []reply{{5, 4, 8}, {0, 0, 4}}, want: Overlaps{5}},
+		{name: "rows border", replies: []reply{{0, 0, 4}, {5, 5, 9}, {10, 10, 14}}},
+		{name: "pages", pages: true, replies: []reply{{1, 0, 4}, {2, 4, 8}, {3, 8, 12}}, want: Overlaps{2, 3}},
+		{name: "pages reversed", pages: true, replies: []reply{{2, 4, 8}, {1, 0, 4}}, want: Overlaps{2}},
+		{name: "pages border", pages: true, replies: []reply{{1, 0, 4}, {2, 5, 9}}},
+		{name: "pages by rows", pages: true, replies: []reply{{1, 0, 4}, {6, 4, 8}}},
+		{name: "pruned", replies: []reply{{0, 0, 4}, {325, 325, 329}, {5, 4, 8}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Overlaps
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(slog.New(&got))
+			p := &Page{Offset: "o", Limit: "l", Pages: tt.pages, Overlap: true}
+			for _, r := range tt.replies {
+				URL := url.URL{RawQuery: fmt.Sprintf("l=5&o=%d", r.offset)}
+				err := p.Follow(&Reply{URL: URL, First: Seen{ID: r.first}, Last: Seen{ID: r.last}})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Follow() overlaps = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPage_Page(t *testing.T) {
+	tests := []struct {
+		name  string
+		page  *Page
+		start int
+		want  []string
+	}{
+		{name: "rows", page: &Page{Offset: "o", Limit: "l"}, want: []string{"l=5&o=0", "l=5&o=5", "l=5&o=10"}},
+		{name: "one", page: &Page{Offset: "o", Limit: "l", Base: 1}, want: []string{"l=5&o=1", "l=5&o=6", "l=5&o=11"}},
+		{name: "pages", page: &Page{Offset: "o", Limit: "l", Pages: true, Base: 1}, want: []string{"l=5&o=1", "l=5&o=2", "l=5&o=3"}},
+		{name: "seek", page: &Page{Offset: "o", Limit: "l", Pages: true}, start: 10, want: []string{"l=5&o=2", "l=5&o=3", "l=5&o=4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.page.Seek(tt.start)
+			for _, want := range tt.want {
+				got, err := tt.page.Page(5)
+				if err != nil || got.RawQuery != want {
+					t.Errorf("Page() = %v, %v, want %v", got.RawQuery, err, want)
+				}
+			}
+		})
+	}
+}
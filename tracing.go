@@ -0,0 +1,49 @@
+package sap_segmentation
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scope = "github.com/pshvedko/sap_segmentation"
+
+// tracer comes from the global provider, spans are no-op until one is set
+func tracer() trace.Tracer {
+	return otel.Tracer(scope)
+}
+
+func finish(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+type TD[T Putter[T]] struct {
+	Driver[T]
+}
+
+func (d TD[T]) Save(ctx context.Context, item T) (T, error) {
+	ctx, span := tracer().Start(ctx, "save", trace.WithSpanKind(trace.SpanKindClient))
+	item, err := d.Driver.Save(ctx, item)
+	finish(span, err)
+	return item, err
+}
+
+func (d TD[T]) SaveBatch(ctx context.Context, items []T) ([]T, error) {
+	ctx, span := tracer().Start(ctx, "save batch", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("batch.size", len(items))))
+	saved, err := d.Driver.SaveBatch(ctx, items)
+	span.SetAttributes(attribute.Int("batch.saved", len(saved)))
+	finish(span, err)
+	return saved, err
+}
+
+func TraceDriver[T Putter[T]](driver Driver[T]) Driver[T] {
+	return TD[T]{Driver: driver}
+}
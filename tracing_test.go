@@ -0,0 +1,76 @@
+package sap_segmentation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	global := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(global) })
+
+	importer, err := NewImporter(8, &sqlx.DB{}, newTestLoader(t, 30, func(offset int) Diffed {
+		return Diffed{ID: offset}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = importer.
+		WithDriver(DryDriver[Diffed](nil, nil), TraceDriver[Diffed]).
+		Import(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]int{}
+	var run sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		spans[span.Name()]++
+		if span.Name() == "import" {
+			run = span
+		}
+	}
+	if run == nil {
+		t.Fatal("no import span")
+	}
+
+	// the page after the last one is fetched empty
+	want := map[string]int{"import": 1, "page": 5, "decode": 5, "save batch": 4}
+	for name, n := range want {
+		if spans[name] != n {
+			t.Errorf("%s spans = %d, want %d", name, spans[name], n)
+		}
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() != run.SpanContext().TraceID() {
+			t.Errorf("%s span is out of the run trace", span.Name())
+		}
+	}
+}
+
+func TestGet_Traceparent(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.TODO(), "test")
+	defer span.End()
+
+	var g Get[Diffed]
+	r, err := g.NewRequestWithContext(ctx, "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+	if got := r.Header.Get("traceparent"); got != want {
+		t.Errorf("traceparent = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,43 @@
+package sap_segmentation
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type txKey struct{}
+
+func ContextWithTx(ctx context.Context, tx *sqlx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sqlx.Tx)
+	return tx, ok
+}
+
+func Ext(ctx context.Context, db *sqlx.DB) sqlx.ExtContext {
+	tx, ok := TxFromContext(ctx)
+	if ok {
+		return tx
+	}
+	return db
+}
+
+func Transaction(ctx context.Context, db *sqlx.DB, f func(context.Context) error) error {
+	_, ok := TxFromContext(ctx)
+	if ok {
+		return f(ctx)
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = f(ContextWithTx(ctx, tx))
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
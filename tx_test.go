@@ -0,0 +1,187 @@
+package sap_segmentation
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Row is saved into tx_test, whose check fails the row 13
+type Row struct {
+	ID int `json:"id"`
+}
+
+func (r Row) Put(ctx context.Context, db sqlx.ExtContext) (Row, error) {
+	_, err := db.ExecContext(ctx, `INSERT INTO tx_test(id) VALUES ($1)`, r.ID)
+	return r, err
+}
+
+func newTestDB(t *testing.T) *sqlx.DB {
+	name := os.Getenv("TEST_SAP_SEGMENTATION_DB")
+	if name == "" {
+		t.SkipNow()
+	}
+	db, err := sqlx.Open("pgx", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS tx_test(id int PRIMARY KEY CHECK (id <> 13))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = db.Exec(`DROP TABLE IF EXISTS tx_test`) })
+	return db
+}
+
+func TestImport_Atomicity(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		atomicity  Atomicity
+		rows       int
+		checkpoint int
+	}{
+		{atomicity: AtomicRow, rows: 13, checkpoint: 8},
+		{atomicity: AtomicPage, rows: 8, checkpoint: 8},
+		{atomicity: AtomicRun, rows: 0, checkpoint: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.atomicity.String(), func(t *testing.T) {
+			_, err := db.Exec(`TRUNCATE tx_test`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loader := newTestLoader(t, 30, func(offset int) Row {
+				return Row{ID: offset}
+			})
+			importer, err := NewImporter(8, db, loader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the checkpoint of a page is written in its transaction
+			checkpoint := NewCheckpoint(db, url.URL{Scheme: "test", Host: t.Name()})
+			t.Cleanup(func() { _, _ = db.Exec(`DELETE FROM checkpoint WHERE source = $1`, checkpoint.Source) })
+
+			err = importer.Import(context.TODO(), WithAtomicity(tt.atomicity), WithCheckpoint(checkpoint))
+			if err == nil {
+				t.Fatal("Import() error = nil, want the row 13 to fail")
+			}
+
+			var rows int
+			err = db.Get(&rows, `SELECT count(*) FROM tx_test`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows != tt.rows {
+				t.Errorf("Import() rows = %d, want %d", rows, tt.rows)
+			}
+
+			offset := -1
+			err = db.Get(&offset, `SELECT "offset" FROM checkpoint WHERE source = $1`, checkpoint.Source)
+			if err != nil && tt.checkpoint >= 0 {
+				t.Fatal(err)
+			}
+			if offset != tt.checkpoint {
+				t.Errorf("Import() checkpoint = %d, want %d", offset, tt.checkpoint)
+			}
+		})
+	}
+}
+
+func TestImport_Savepoint(t *testing.T) {
+	db := newTestDB(t)
+
+	importer, err := NewImporter(8, db, newTestLoader(t, 30, func(offset int) Row {
+		return Row{ID: offset}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed batch is rolled back to its savepoint and saved again row by row in the same transaction
+	var rejects Rejects
+	err = importer.Import(context.TODO(), WithAtomicity(AtomicPage), WithQuarantine(&rejects, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows int
+	err = db.Get(&rows, `SELECT count(*) FROM tx_test`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 29 || len(rejects) != 1 || rejects[0] != 13 {
+		t.Errorf("Import() rows = %d, rejects = %v, want 29 and [13]", rows, rejects)
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	db := newTestDB(t)
+
+	err := Transaction(context.TODO(), db, func(ctx context.Context) error {
+		err := Savepoint(ctx, func(ctx context.Context) error {
+			_, err := Row{ID: 13}.Put(ctx, Ext(ctx, db))
+			return err
+		})
+		if err == nil {
+			t.Error("Savepoint() error = nil, want the check to fail")
+		}
+		// the transaction goes on after the savepoint is rolled back
+		_, err = Row{ID: 1}.Put(ctx, Ext(ctx, db))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows int
+	err = db.Get(&rows, `SELECT count(*) FROM tx_test WHERE id = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Errorf("Transaction() rows = %d, want 1", rows)
+	}
+}
+
+func TestImport_Resume(t *testing.T) {
+	db := newTestDB(t)
+
+	importer, err := NewImporter(8, db, newTestLoader(t, 12, func(offset int) Row {
+		return Row{ID: offset}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint := NewCheckpoint(db, url.URL{Scheme: "test", Host: t.Name()})
+	t.Cleanup(func() { _, _ = db.Exec(`DELETE FROM checkpoint WHERE source = $1`, checkpoint.Source) })
+
+	// the checkpoint of a failed run is kept
+	err = checkpoint.Checkpoint(context.TODO(), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = importer.Import(context.TODO(), WithCheckpoint(checkpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the complete run clears it, so that a resume starts from 0
+	offset, err := checkpoint.Resume(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 0 {
+		t.Errorf("Resume() = %d, want 0", offset)
+	}
+}